@@ -1,8 +1,19 @@
 package neslink
 
+import "errors"
+
+var (
+	// ErrConflict is returned by the ensure variants of actions when an object
+	// of the same name (or key) already exists, but does not match what the
+	// action would have created. This may be wrapped into other errors, so
+	// errors.Is should be used to check for its presence.
+	ErrConflict error = errors.New("an existing object conflicts with the requested one")
+)
+
 // Action represents an entity that has a name and some function (act) that can
 // return an error.
 type Action interface {
 	name() string
 	act() error
+	descriptor() Descriptor
 }
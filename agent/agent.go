@@ -0,0 +1,143 @@
+// Package agent allows neslink actions to be performed on a remote host. A
+// Server runs on the host with the namespaces, accepting requests over HTTP
+// (with JSON bodies) that give the descriptors of an NsProvider and a list of
+// actions. These are built and performed via neslink.DoReport, with the result
+// of each action streamed back as it completes. For example, on the host:
+//
+//	l, err := agent.ListenUnix("/run/neslink.sock", 0600)
+//	...
+//	err = agent.NewServer().Serve(l)
+//
+// And in the orchestrator, using the usual neslink constructors:
+//
+//	c := agent.NewUnixClient("/run/neslink.sock")
+//	results, err := c.Do(ctx, neslink.NPName("red"),
+//		neslink.LANewBridge("br0"),
+//		neslink.LASetUp(neslink.LPName("br0")),
+//		neslink.NALinks(nil),
+//	)
+//
+// Only actions and providers with descriptors (see neslink.Descriptor) can be
+// sent, and custom kinds must be registered in the server as well as the
+// client. The pointers given to actions that output values are not written to
+// by the client. Instead, the output of NALinks, NAAddrs, NAGetLink, LAGetAddrs,
+// NAGetNetNsID and NAVethPeer is returned in the Output of their Result, which
+// can be decoded via Result.Decode.
+//
+// As the agent can modify any namespace on the host, requests must be
+// authenticated. The server should only be served on a listener from
+// ListenUnix, where access is controlled by the permissions of the socket, or
+// from ListenTLS, which requires clients to present a certificate signed by a
+// trusted CA (mTLS).
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+	"github.com/willfantom/neslink"
+)
+
+const (
+	// doPath is the path requests to perform actions are sent to.
+	doPath string = "/v1/do"
+
+	// streamContentType is the content type of a streamed response, which
+	// contains a json object per line.
+	streamContentType string = "application/x-ndjson"
+)
+
+// Request is the body of a request to the server, giving the netns to perform
+// the actions in.
+type Request struct {
+	Ns      neslink.Descriptor   `json:"ns"`
+	Actions []neslink.Descriptor `json:"actions"`
+}
+
+// Result is the outcome of a single action performed by the server.
+type Result struct {
+	Index  int             `json:"index"`
+	Action string          `json:"action"`
+	Error  string          `json:"error,omitempty"`
+	Output json.RawMessage `json:"output,omitempty"`
+}
+
+// Decode decodes the output of the action into v, which should be a pointer to
+// the type the action outputs: *[]LinkInfo for NALinks, *[]AddrInfo for
+// NAAddrs and LAGetAddrs, *LinkInfo for NAGetLink, *int for NAGetNetNsID, and
+// *VethPeer for NAVethPeer.
+func (r Result) Decode(v any) error {
+	if len(r.Output) == 0 {
+		return fmt.Errorf("action %d (%s) has no output", r.Index+1, r.Action)
+	}
+	return json.Unmarshal(r.Output, v)
+}
+
+// event is a single line of a streamed response. Each action performed results
+// in an event with a Result, and the stream ends with an event where Done is
+// set, along with the overall error of the request (if any).
+type event struct {
+	Result *Result `json:"result,omitempty"`
+	Done   bool    `json:"done,omitempty"`
+	Error  string  `json:"error,omitempty"`
+}
+
+// LinkInfo describes a link output by an action.
+type LinkInfo struct {
+	Index        int    `json:"index"`
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+	State        string `json:"state"`
+	Up           bool   `json:"up"`
+	MTU          int    `json:"mtu"`
+	HardwareAddr string `json:"hardwareAddr,omitempty"`
+	Alias        string `json:"alias,omitempty"`
+	MasterIndex  int    `json:"masterIndex,omitempty"`
+}
+
+// AddrInfo describes an address output by an action.
+type AddrInfo struct {
+	LinkIndex int    `json:"linkIndex"`
+	Addr      string `json:"addr"`
+	Scope     string `json:"scope"`
+	Label     string `json:"label,omitempty"`
+}
+
+// VethPeer describes the peer of a veth output by NAVethPeer. The providers are
+// resolved on the server, and so should only be used in later requests to the
+// same server.
+type VethPeer struct {
+	Ns   neslink.NsProvider   `json:"ns"`
+	Link neslink.LinkProvider `json:"link"`
+}
+
+// linkInfo creates the LinkInfo for a link.
+func linkInfo(l netlink.Link) LinkInfo {
+	attrs := l.Attrs()
+	info := LinkInfo{
+		Index:       attrs.Index,
+		Name:        attrs.Name,
+		Type:        l.Type(),
+		State:       attrs.OperState.String(),
+		Up:          attrs.Flags&net.FlagUp != 0,
+		MTU:         attrs.MTU,
+		Alias:       attrs.Alias,
+		MasterIndex: attrs.MasterIndex,
+	}
+	if attrs.HardwareAddr != nil {
+		info.HardwareAddr = attrs.HardwareAddr.String()
+	}
+	return info
+}
+
+// addrInfo creates the AddrInfo for an address.
+func addrInfo(a netlink.Addr) AddrInfo {
+	return AddrInfo{
+		LinkIndex: a.LinkIndex,
+		Addr:      a.IPNet.String(),
+		Scope:     netlink.Scope(a.Scope).String(),
+		Label:     a.Label,
+	}
+}
@@ -0,0 +1,247 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"github.com/willfantom/neslink"
+	"github.com/willfantom/neslink/fake"
+	"github.com/willfantom/neslink/neslinktest"
+)
+
+func TestMain(m *testing.M) {
+	neslinktest.Main(m)
+}
+
+// newTestServer serves a new agent server on a unix socket, returning a client
+// of it.
+func newTestServer(t *testing.T) *Client {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "neslink.sock")
+	l, err := ListenUnix(path, 0600)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go NewServer().Serve(l)
+	return NewUnixClient(path)
+}
+
+// useFake replaces the backend with a new fake for the duration of the test.
+func useFake(t *testing.T) {
+	t.Helper()
+	prev := neslink.SetBackend(fake.New())
+	t.Cleanup(func() { neslink.SetBackend(prev) })
+}
+
+func TestDo(t *testing.T) {
+	useFake(t)
+	c := newTestServer(t)
+	br0 := neslink.LPName("br0")
+	results, err := c.Do(context.Background(), neslink.NPNow(),
+		neslink.LANewBridge("br0"),
+		neslink.LASetMTU(br0, 9000),
+		neslink.LAAddAddr(br0, "10.0.0.1/24"),
+		neslink.NALinks(nil),
+		neslink.NAGetLink(br0, nil),
+		neslink.LAGetAddrs(br0, netlink.FAMILY_V4, nil),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 6 {
+		t.Fatalf("expected 6 results, got %d", len(results))
+	}
+	for idx, r := range results {
+		if r.Index != idx || r.Error != "" {
+			t.Errorf("unexpected result %d: %+v", idx, r)
+		}
+	}
+	if results[0].Action != "new-bridge" || len(results[0].Output) != 0 {
+		t.Errorf("unexpected result for an action without output: %+v", results[0])
+	}
+
+	var links []LinkInfo
+	if err := results[3].Decode(&links); err != nil {
+		t.Fatalf("failed to decode links: %v", err)
+	}
+	if len(links) != 2 || links[1].Name != "br0" || links[1].Type != "bridge" {
+		t.Errorf("unexpected links: %+v", links)
+	}
+	var link LinkInfo
+	if err := results[4].Decode(&link); err != nil {
+		t.Fatalf("failed to decode link: %v", err)
+	}
+	if link.Name != "br0" || link.MTU != 9000 {
+		t.Errorf("unexpected link: %+v", link)
+	}
+	var addrs []AddrInfo
+	if err := results[5].Decode(&addrs); err != nil {
+		t.Fatalf("failed to decode addresses: %v", err)
+	}
+	if len(addrs) != 1 || addrs[0].Addr != "10.0.0.1/24" || addrs[0].LinkIndex != link.Index {
+		t.Errorf("unexpected addresses: %+v", addrs)
+	}
+}
+
+func TestDoFailure(t *testing.T) {
+	useFake(t)
+	c := newTestServer(t)
+	results, err := c.Do(context.Background(), neslink.NPNow(),
+		neslink.LANewBridge("br0"),
+		neslink.LASetUp(neslink.LPName("missing")),
+		neslink.LANewBridge("br1"),
+	)
+	if !errors.Is(err, ErrRemote) {
+		t.Fatalf("expected an error wrapping ErrRemote, got %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if results[0].Error != "" || results[1].Error == "" {
+		t.Errorf("unexpected results: %+v", results)
+	}
+	var out LinkInfo
+	if err := results[1].Decode(&out); err == nil {
+		t.Error("expected an error decoding the output of a failed action")
+	}
+}
+
+func TestDoStream(t *testing.T) {
+	useFake(t)
+	c := newTestServer(t)
+	body, err := json.Marshal(Request{
+		Ns: neslink.NPNow().Descriptor(),
+		Actions: []neslink.Descriptor{
+			neslink.LANewBridge("br0").Descriptor(),
+			neslink.NAAddrs(netlink.FAMILY_ALL, nil).Descriptor(),
+			neslink.LANewBridge("br0").Descriptor(),
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to encode request: %v", err)
+	}
+	resp, err := c.client.Post(c.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != streamContentType {
+		t.Fatalf("unexpected response: %s (%s)", resp.Status, resp.Header.Get("Content-Type"))
+	}
+
+	// each line is a single event, with the last marking the end of the stream
+	events := []event{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var e event
+		dec := json.NewDecoder(strings.NewReader(scanner.Text()))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("failed to decode line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, e)
+	}
+	if len(events) != 4 {
+		t.Fatalf("expected 4 events, got %d", len(events))
+	}
+	for idx, e := range events[:3] {
+		if e.Result == nil || e.Result.Index != idx || e.Done {
+			t.Errorf("unexpected event %d: %+v", idx, e)
+		}
+	}
+	if len(events[1].Result.Output) == 0 {
+		t.Error("expected the addresses to be output")
+	}
+	if events[2].Result.Error == "" {
+		t.Error("expected the duplicate bridge to fail")
+	}
+	if last := events[3]; !last.Done || last.Error == "" || last.Result != nil {
+		t.Errorf("unexpected final event: %+v", last)
+	}
+}
+
+func TestDoInvalid(t *testing.T) {
+	useFake(t)
+	c := newTestServer(t)
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+	}{
+		{name: "method", method: http.MethodGet, status: http.StatusMethodNotAllowed},
+		{name: "malformed", method: http.MethodPost, body: `{"ns":`, status: http.StatusBadRequest},
+		{name: "unknown field", method: http.MethodPost, body: `{"ns":{"kind":"NPNow"},"actions":[],"extra":1}`, status: http.StatusBadRequest},
+		{name: "unknown ns kind", method: http.MethodPost, body: `{"ns":{"kind":"NPMissing"},"actions":[]}`, status: http.StatusBadRequest},
+		{name: "unknown action kind", method: http.MethodPost, body: `{"ns":{"kind":"NPNow"},"actions":[{"kind":"LANewBridge","params":["br0"]},{"kind":"LAMissing"}]}`, status: http.StatusBadRequest},
+		{name: "unregistered kind", method: http.MethodPost, body: `{"ns":{"kind":"NPNow"},"actions":[{"kind":"wireguard.LAGetDevice","params":[{"kind":"LPName","params":["wg0"]}]}]}`, status: http.StatusBadRequest},
+		{name: "bad params", method: http.MethodPost, body: `{"ns":{"kind":"NPNow"},"actions":[{"kind":"NAVethPeer","params":[1]}]}`, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, c.url, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+			resp, err := c.client.Do(req)
+			if err != nil {
+				t.Fatalf("failed to send request: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Fatalf("expected status %d, got %s", tt.status, resp.Status)
+			}
+			var e event
+			if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Error == "" {
+				t.Errorf("expected an error event, got %+v (%v)", e, err)
+			}
+		})
+	}
+	// nothing is performed for a rejected request
+	var links []netlink.Link
+	if err := neslink.Do(neslink.NPNow(), neslink.NALinks(&links)); err != nil {
+		t.Fatalf("failed to list links: %v", err)
+	}
+	if len(links) != 1 {
+		t.Errorf("expected only the loopback link, got %d links", len(links))
+	}
+}
+
+func TestVethPeer(t *testing.T) {
+	neslinktest.Require(t)
+	c := newTestServer(t)
+	results, err := c.Do(context.Background(), neslink.NPNow(),
+		neslink.LANewVeth("v0", "v1"),
+		neslink.NAVethPeer(neslink.LPName("v0"), nil, nil),
+	)
+	t.Cleanup(func() { neslink.Do(neslink.NPNow(), neslink.LADelete(neslink.LPName("v0"))) })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var peer VethPeer
+	if err := results[1].Decode(&peer); err != nil {
+		t.Fatalf("failed to decode veth peer: %v", err)
+	}
+
+	// the peer providers can be used in a later request
+	results, err = c.Do(context.Background(), peer.Ns, neslink.NAGetLink(peer.Link, nil))
+	if err != nil {
+		t.Fatalf("failed to get peer: %v", err)
+	}
+	var link LinkInfo
+	if err := results[0].Decode(&link); err != nil {
+		t.Fatalf("failed to decode link: %v", err)
+	}
+	if link.Name != "v1" {
+		t.Errorf("expected peer v1, got %s", link.Name)
+	}
+}
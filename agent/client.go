@@ -0,0 +1,132 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/willfantom/neslink"
+)
+
+var (
+	// ErrRemote is returned by the client when the server fails to perform the
+	// actions of a request, such as when an action fails or the netns can not
+	// be provided. The message of the server's error is included, and so
+	// errors.Is should be used to check for its presence.
+	ErrRemote error = errors.New("remote do failed")
+)
+
+// Client sends requests to an agent server. It should be created via
+// NewUnixClient or NewTLSClient.
+type Client struct {
+	client *http.Client
+	url    string
+}
+
+// NewUnixClient creates a client of the server listening on the unix socket at
+// the given path.
+func NewUnixClient(path string) *Client {
+	dialer := &net.Dialer{}
+	return &Client{
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", path)
+				},
+			},
+		},
+		url: "http://neslink" + doPath,
+	}
+}
+
+// NewTLSClient creates a client of the server listening at the given address
+// (host:port), using the given tls config (such as from ClientTLSConfig).
+func NewTLSClient(addr string, config *tls.Config) *Client {
+	return &Client{
+		client: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: config,
+			},
+		},
+		url: "https://" + addr + doPath,
+	}
+}
+
+// Do performs the given actions in the netns provided by nsP on the server,
+// returning the result of each action that was performed. If any action fails,
+// the results up to and including the failed action are returned along with an
+// error wrapping ErrRemote. An error is returned without anything being sent if
+// the provider or any action has no descriptor.
+func (c *Client) Do(ctx context.Context, nsP neslink.NsProvider, actions ...neslink.Action) ([]Result, error) {
+	results := []Result{}
+	err := c.Stream(ctx, nsP, func(r Result) {
+		results = append(results, r)
+	}, actions...)
+	return results, err
+}
+
+// Stream is the same as Do, but calls report with the result of each action as
+// soon as it is received from the server.
+func (c *Client) Stream(ctx context.Context, nsP neslink.NsProvider, report func(Result), actions ...neslink.Action) error {
+	request := Request{
+		Ns:      nsP.Descriptor(),
+		Actions: make([]neslink.Descriptor, len(actions)),
+	}
+	if err := request.Ns.Err(); err != nil {
+		return fmt.Errorf("failed to describe netns provider: %w", err)
+	}
+	for idx, action := range actions {
+		d, err := neslink.Describe(action)
+		if err != nil {
+			return fmt.Errorf("action %d: %w", idx+1, err)
+		}
+		request.Actions[idx] = d
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		var e event
+		if err := dec.Decode(&e); err != nil || e.Error == "" {
+			return fmt.Errorf("request failed: %s", resp.Status)
+		}
+		return fmt.Errorf("request failed: %s: %s", resp.Status, e.Error)
+	}
+	for {
+		var e event
+		if err := dec.Decode(&e); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+		if e.Done {
+			if e.Error != "" {
+				return fmt.Errorf("%w: %s", ErrRemote, e.Error)
+			}
+			return nil
+		}
+		if e.Result != nil && report != nil {
+			report(*e.Result)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/vishvananda/netlink"
+	"github.com/willfantom/neslink"
+)
+
+// output returns the value output by an action once it has been performed, to
+// be encoded as the Output of its result.
+type output func() any
+
+// outputs builds the actions of kinds that output values, along with their
+// output. These are built here rather than via neslink.BuildAction so that the
+// pointers the actions output to can be read.
+var outputs = map[string]func(neslink.Descriptor) (neslink.Action, output, error){
+	"NALinks": func(d neslink.Descriptor) (neslink.Action, output, error) {
+		if err := d.Args(); err != nil {
+			return nil, nil, err
+		}
+		links := []netlink.Link{}
+		return neslink.NALinks(&links), linkInfos(&links), nil
+	},
+	"NAAddrs": func(d neslink.Descriptor) (neslink.Action, output, error) {
+		var family int
+		if err := d.Args(&family); err != nil {
+			return nil, nil, err
+		}
+		addrs := []netlink.Addr{}
+		return neslink.NAAddrs(family, &addrs), addrInfos(&addrs), nil
+	},
+	"NAGetLink": func(d neslink.Descriptor) (neslink.Action, output, error) {
+		var provider neslink.LinkProvider
+		if err := d.Args(&provider); err != nil {
+			return nil, nil, err
+		}
+		var link netlink.Link
+		return neslink.NAGetLink(provider, &link), func() any { return linkInfo(link) }, nil
+	},
+	"LAGetAddrs": func(d neslink.Descriptor) (neslink.Action, output, error) {
+		var provider neslink.LinkProvider
+		var family int
+		if err := d.Args(&provider, &family); err != nil {
+			return nil, nil, err
+		}
+		addrs := []netlink.Addr{}
+		return neslink.LAGetAddrs(provider, family, &addrs), addrInfos(&addrs), nil
+	},
+	"NAGetNetNsID": func(d neslink.Descriptor) (neslink.Action, output, error) {
+		var nsP neslink.NsProvider
+		if err := d.Args(&nsP); err != nil {
+			return nil, nil, err
+		}
+		var nsid int
+		return neslink.NAGetNetNsID(nsP, &nsid), func() any { return nsid }, nil
+	},
+	"NAVethPeer": func(d neslink.Descriptor) (neslink.Action, output, error) {
+		var provider neslink.LinkProvider
+		if err := d.Args(&provider); err != nil {
+			return nil, nil, err
+		}
+		var peer VethPeer
+		return neslink.NAVethPeer(provider, &peer.Ns, &peer.Link), func() any { return peer }, nil
+	},
+}
+
+// buildAction builds the action described by the given descriptor, along with
+// its output (nil if it has none).
+func buildAction(d neslink.Descriptor) (neslink.Action, output, error) {
+	build, ok := outputs[d.Kind]
+	if !ok {
+		a, err := neslink.BuildAction(d)
+		return a, nil, err
+	}
+	a, out, err := build(d)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build action %s: %w", d.Kind, err)
+	}
+	return a, out, nil
+}
+
+// linkInfos returns an output of the given links as a []LinkInfo.
+func linkInfos(links *[]netlink.Link) output {
+	return func() any {
+		infos := make([]LinkInfo, 0, len(*links))
+		for _, l := range *links {
+			infos = append(infos, linkInfo(l))
+		}
+		return infos
+	}
+}
+
+// addrInfos returns an output of the given addresses as a []AddrInfo.
+func addrInfos(addrs *[]netlink.Addr) output {
+	return func() any {
+		infos := make([]AddrInfo, 0, len(*addrs))
+		for _, a := range *addrs {
+			infos = append(infos, addrInfo(a))
+		}
+		return infos
+	}
+}
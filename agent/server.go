@@ -0,0 +1,202 @@
+package agent
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/willfantom/neslink"
+)
+
+const (
+	// maxRequestSize is the largest request body the server accepts.
+	maxRequestSize int64 = 1 << 20
+)
+
+var (
+	// errNoClientAuth is returned by ListenTLS when the given config does not
+	// require clients to present a verified certificate.
+	errNoClientAuth error = errors.New("tls config must require and verify client certificates")
+)
+
+// Server performs the actions described by the requests it receives. It should
+// be created via NewServer.
+type Server struct {
+	mux *http.ServeMux
+}
+
+// NewServer creates a new agent server.
+func NewServer() *Server {
+	s := &Server{
+		mux: http.NewServeMux(),
+	}
+	s.mux.HandleFunc(doPath, s.handleDo)
+	return s
+}
+
+// ServeHTTP allows the server to be used as a http.Handler, such as when it is
+// served alongside other handlers. Callers doing so are responsible for
+// authenticating requests.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Serve accepts connections on the given listener, which should be created via
+// ListenUnix or ListenTLS, serving requests until the listener is closed.
+func (s *Server) Serve(l net.Listener) error {
+	srv := &http.Server{Handler: s}
+	return srv.Serve(l)
+}
+
+// handleDo builds the netns provider and actions of a request from their
+// descriptors, performing them via neslink.DoReport and streaming back the
+// result of each action as it is performed. Invalid requests are rejected
+// before any action is performed.
+func (s *Server) handleDo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	var req Request
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+	nsP, err := neslink.BuildNsProvider(req.Ns)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	actions := make([]neslink.Action, len(req.Actions))
+	outs := make([]output, len(req.Actions))
+	for idx, d := range req.Actions {
+		if actions[idx], outs[idx], err = buildAction(d); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("action %d: %w", idx+1, err))
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", streamContentType)
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	send := func(e event) {
+		// write errors mean the client has gone, but the actions must continue
+		enc.Encode(e)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	err = neslink.DoReport(nsP, func(ar neslink.ActionResult) {
+		result := Result{Index: ar.Index, Action: ar.Name}
+		if ar.Err != nil {
+			result.Error = ar.Err.Error()
+		} else if out := outs[ar.Index]; out != nil {
+			b, err := json.Marshal(out())
+			if err != nil {
+				result.Error = fmt.Sprintf("failed to encode output: %v", err)
+			}
+			result.Output = b
+		}
+		send(event{Result: &result})
+	}, actions...)
+	done := event{Done: true}
+	if err != nil {
+		done.Error = err.Error()
+	}
+	send(done)
+}
+
+// writeError responds to a request with the given status and error.
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(event{Error: err.Error()})
+}
+
+// ListenUnix listens on a unix socket at the given path, setting the socket's
+// permissions to perm. Only users that can write to the socket can connect to
+// it, so perm should be restrictive (e.g. 0600 or 0660).
+func ListenUnix(path string, perm os.FileMode) (net.Listener, error) {
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on unix socket: %w", err)
+	}
+	if err := os.Chmod(path, perm); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to set unix socket permissions: %w", err)
+	}
+	return l, nil
+}
+
+// ListenTLS listens for tcp connections on the given address, using the given
+// tls config. The config must require and verify client certificates (as with
+// ServerTLSConfig), so that only clients with certificates signed by a trusted
+// CA can connect.
+func ListenTLS(addr string, config *tls.Config) (net.Listener, error) {
+	if config == nil || config.ClientAuth != tls.RequireAndVerifyClientCert || config.ClientCAs == nil {
+		return nil, errNoClientAuth
+	}
+	l, err := tls.Listen("tcp", addr, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for tls connections: %w", err)
+	}
+	return l, nil
+}
+
+// ServerTLSConfig creates a tls config for a server using the certificate and
+// key in the given PEM files, that requires clients to present a certificate
+// signed by a CA in caFile.
+func ServerTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, pool, err := loadTLSFiles(certFile, keyFile, caFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// ClientTLSConfig creates a tls config for a client using the certificate and
+// key in the given PEM files, that trusts servers with a certificate signed by
+// a CA in caFile.
+func ClientTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, pool, err := loadTLSFiles(certFile, keyFile, caFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// loadTLSFiles loads a certificate and key pair, and a pool of CA
+// certificates, from the given PEM files.
+func loadTLSFiles(certFile, keyFile, caFile string) (tls.Certificate, *x509.CertPool, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+	ca, err := os.ReadFile(caFile)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("failed to read ca file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return tls.Certificate{}, nil, fmt.Errorf("no certificates found in ca file %s", caFile)
+	}
+	return cert, pool, nil
+}
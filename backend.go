@@ -0,0 +1,260 @@
+package neslink
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"runtime"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// Backend is the set of netlink and netns operations that Do, the link and
+// netns providers, and most actions are built on. By default these operations
+// are performed on the kernel, but another backend (such as the in-memory one
+// in the fake package) can be used via SetBackend, allowing code built on
+// neslink to be tested without privileges. The link, address and route
+// operations have the same form as those of a netlink.Handle.
+type Backend interface {
+	// LockThread and UnlockThread wrap the execution of actions in Do, which
+	// for the kernel locks the goroutine to its OS thread.
+	LockThread()
+	UnlockThread()
+
+	// CurrentNs returns the path of the netns of the calling thread.
+	CurrentNs() (Namespace, error)
+	// OpenNs opens the netns at the given path. If the path does not exist,
+	// the error should wrap fs.ErrNotExist.
+	OpenNs(ns Namespace) (NsFd, error)
+	// CloseNs closes a netns opened via OpenNs.
+	CloseNs(fd NsFd) error
+	// SetNs moves the calling thread to the netns of the given fd.
+	SetNs(fd NsFd) error
+	// ValidateNs checks that the given path is a netns.
+	ValidateNs(ns Namespace) error
+	// IdentifyNs returns the identity of the netns at the given path, which is
+	// the same for every path of that netns.
+	IdentifyNs(ns Namespace) (NsID, error)
+	// NewNsAt creates a new netns, moves the calling thread to it and binds it
+	// to the given path, erroring if the path already exists.
+	NewNsAt(mountpath string) error
+	// DeleteNsAt unbinds the netns bound to the given path.
+	DeleteNsAt(mountpath string) error
+	// NetNsID returns the netnsid that the netns of origin has assigned to the
+	// netns of target, or -1 if none has been assigned.
+	NetNsID(origin, target NsFd) (int, error)
+	// SetNetNsID assigns the given netnsid to the netns of target, as seen from
+	// the netns of origin.
+	SetNetNsID(origin, target NsFd, nsid int) error
+
+	LinkAdd(link netlink.Link) error
+	LinkDel(link netlink.Link) error
+	// LinkByName, LinkByIndex and LinkByAlias return an error matching
+	// ErrLinkNotFound (via errors.Is) if there is no such link.
+	LinkByName(name string) (netlink.Link, error)
+	LinkByIndex(index int) (netlink.Link, error)
+	LinkByAlias(alias string) (netlink.Link, error)
+	LinkList() ([]netlink.Link, error)
+	LinkSetUp(link netlink.Link) error
+	LinkSetDown(link netlink.Link) error
+	LinkSetName(link netlink.Link, name string) error
+	LinkSetAlias(link netlink.Link, alias string) error
+	LinkSetHardwareAddr(link netlink.Link, hwaddr net.HardwareAddr) error
+	LinkSetMTU(link netlink.Link, mtu int) error
+	LinkSetTxQLen(link netlink.Link, qlen int) error
+	LinkSetGroup(link netlink.Link, group int) error
+	LinkSetGSOMaxSize(link netlink.Link, maxSize int) error
+	LinkSetGSOMaxSegs(link netlink.Link, maxSegs int) error
+	LinkSetGROMaxSize(link netlink.Link, maxSize int) error
+	LinkSetMaster(link netlink.Link, master netlink.Link) error
+	LinkSetNoMaster(link netlink.Link) error
+	LinkSetNsFd(link netlink.Link, fd int) error
+	LinkAddAltName(link netlink.Link, name string) error
+	LinkDelAltName(link netlink.Link, name string) error
+	SetPromiscOn(link netlink.Link) error
+	SetPromiscOff(link netlink.Link) error
+	LinkSetMulticastOn(link netlink.Link) error
+	LinkSetMulticastOff(link netlink.Link) error
+	LinkSetAllmulticastOn(link netlink.Link) error
+	LinkSetAllmulticastOff(link netlink.Link) error
+	LinkSetARPOn(link netlink.Link) error
+	LinkSetARPOff(link netlink.Link) error
+
+	AddrAdd(link netlink.Link, addr *netlink.Addr) error
+	AddrReplace(link netlink.Link, addr *netlink.Addr) error
+	AddrDel(link netlink.Link, addr *netlink.Addr) error
+	AddrList(link netlink.Link, family int) ([]netlink.Addr, error)
+
+	RouteAdd(route *netlink.Route) error
+	RouteDel(route *netlink.Route) error
+	RouteList(link netlink.Link, family int) ([]netlink.Route, error)
+
+	FouAdd(f netlink.Fou) error
+	FouDel(f netlink.Fou) error
+
+	// The subscriptions deliver updates for the netns of the calling thread
+	// until done is closed, after which the updates channel is closed.
+	LinkSubscribe(updates chan netlink.LinkUpdate, done chan struct{}, errs func(error)) error
+	AddrSubscribe(updates chan netlink.AddrUpdate, done chan struct{}, errs func(error)) error
+	RouteSubscribe(updates chan netlink.RouteUpdate, done chan struct{}, errs func(error)) error
+}
+
+// backend is the backend used by all of neslink's operations.
+var backend Backend = kernelBackend{&netlink.Handle{}}
+
+// SetBackend replaces the backend used by neslink, returning the one it
+// replaced. Passing nil restores the kernel backend. This is intended for use
+// in tests, and should not be called whilst any Do call is in progress.
+func SetBackend(b Backend) Backend {
+	prev := backend
+	if b == nil {
+		b = kernelBackend{&netlink.Handle{}}
+	}
+	backend = b
+	return prev
+}
+
+// kernelBackend performs operations on the kernel. The zero netlink handle it
+// embeds opens a netlink socket in the netns of the calling thread for each
+// request.
+type kernelBackend struct {
+	*netlink.Handle
+}
+
+func (kernelBackend) LockThread() {
+	runtime.LockOSThread()
+}
+
+func (kernelBackend) UnlockThread() {
+	runtime.UnlockOSThread()
+}
+
+func (b kernelBackend) LinkByName(name string) (netlink.Link, error) {
+	return markLinkNotFound(b.Handle.LinkByName(name))
+}
+
+func (b kernelBackend) LinkByIndex(index int) (netlink.Link, error) {
+	return markLinkNotFound(b.Handle.LinkByIndex(index))
+}
+
+func (b kernelBackend) LinkByAlias(alias string) (netlink.Link, error) {
+	return markLinkNotFound(b.Handle.LinkByAlias(alias))
+}
+
+// linkNotFoundError is an error from netlink for a missing link, marked so
+// that it matches ErrLinkNotFound whilst keeping its message.
+type linkNotFoundError struct {
+	err error
+}
+
+func (e linkNotFoundError) Error() string {
+	return e.err.Error()
+}
+
+func (e linkNotFoundError) Unwrap() error {
+	return e.err
+}
+
+func (linkNotFoundError) Is(target error) bool {
+	return target == ErrLinkNotFound
+}
+
+// markLinkNotFound marks a netlink.LinkNotFoundError so that it matches
+// ErrLinkNotFound.
+func markLinkNotFound(link netlink.Link, err error) (netlink.Link, error) {
+	if errors.As(err, &netlink.LinkNotFoundError{}) {
+		return nil, linkNotFoundError{err}
+	}
+	return link, err
+}
+
+func (kernelBackend) CurrentNs() (Namespace, error) {
+	return Namespace(fmt.Sprintf("/proc/%d/task/%d/ns/net", os.Getpid(), unix.Gettid())), nil
+}
+
+func (kernelBackend) OpenNs(ns Namespace) (NsFd, error) {
+	return ns.open()
+}
+
+func (kernelBackend) CloseNs(fd NsFd) error {
+	return fd.close()
+}
+
+func (kernelBackend) SetNs(fd NsFd) error {
+	return fd.set()
+}
+
+func (kernelBackend) ValidateNs(ns Namespace) error {
+	return ns.Validate()
+}
+
+func (kernelBackend) IdentifyNs(ns Namespace) (NsID, error) {
+	return ns.ID()
+}
+
+func (kernelBackend) NewNsAt(mountpath string) error {
+	// 1. create the mounting dir if required
+	if mountdir := path.Dir(mountpath); mountdir != "" {
+		if _, err := os.Stat(mountdir); os.IsNotExist(err) {
+			if err := os.MkdirAll(mountdir, 0o755); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 2. create the mount file (error if already exists)
+	if _, err := os.Stat(mountpath); os.IsNotExist(err) {
+		mf, err := os.OpenFile(mountpath, os.O_CREATE|os.O_EXCL, 0o444)
+		if err != nil {
+			return fmt.Errorf("failed to create namespace mount file: %w", err)
+		}
+		mf.Close()
+	} else {
+		return fmt.Errorf("namespace mount file already exists")
+	}
+
+	// 3. create new ns and move current pid/tid to it
+	if err := unix.Unshare(unix.CLONE_NEWNET); err != nil {
+		return fmt.Errorf("failed to create and switch to newnets: %w", err)
+	}
+
+	// 4. bind the new ns to the mount file
+	ns, _ := NPNow().Provide()
+	if err := unix.Mount(ns.String(), mountpath, "bind", unix.MS_BIND, ""); err != nil {
+		return fmt.Errorf("failed to mount new netns to mount file: %w", err)
+	}
+	return nil
+}
+
+func (kernelBackend) DeleteNsAt(mountpath string) error {
+	if err := unix.Unmount(mountpath, unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("failed to unmount netns: %w", err)
+	}
+	if err := os.Remove(mountpath); err != nil {
+		return fmt.Errorf("failed to remove netns mount file: %w", err)
+	}
+	return nil
+}
+
+func (kernelBackend) NetNsID(origin, target NsFd) (int, error) {
+	return origin.NetNsID(target)
+}
+
+func (kernelBackend) SetNetNsID(origin, target NsFd, nsid int) error {
+	return origin.SetNetNsID(target, nsid)
+}
+
+func (kernelBackend) LinkSubscribe(updates chan netlink.LinkUpdate, done chan struct{}, errs func(error)) error {
+	return netlink.LinkSubscribeWithOptions(updates, done, netlink.LinkSubscribeOptions{ErrorCallback: errs})
+}
+
+func (kernelBackend) AddrSubscribe(updates chan netlink.AddrUpdate, done chan struct{}, errs func(error)) error {
+	return netlink.AddrSubscribeWithOptions(updates, done, netlink.AddrSubscribeOptions{ErrorCallback: errs})
+}
+
+func (kernelBackend) RouteSubscribe(updates chan netlink.RouteUpdate, done chan struct{}, errs func(error)) error {
+	return netlink.RouteSubscribeWithOptions(updates, done, netlink.RouteSubscribeOptions{ErrorCallback: errs})
+}
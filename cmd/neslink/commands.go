@@ -0,0 +1,416 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/vishvananda/netlink"
+	"github.com/willfantom/neslink"
+	"github.com/willfantom/neslink/docker"
+)
+
+// selector holds the flags used to select the netns commands are performed in.
+type selector struct {
+	name     string
+	path     string
+	pid      int
+	docker   string
+	mountdir string
+}
+
+// provider returns the provider for the selected netns, erroring if more than
+// one netns is selected.
+func (s selector) provider() (neslink.NsProvider, error) {
+	var providers []neslink.NsProvider
+	if s.name != "" {
+		providers = append(providers, neslink.NPNameAt(s.mountdir, s.name))
+	}
+	if s.path != "" {
+		providers = append(providers, neslink.NPPath(s.path))
+	}
+	if s.pid != 0 {
+		providers = append(providers, neslink.NPProcess(s.pid))
+	}
+	if s.docker != "" {
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			return neslink.NsProvider{}, fmt.Errorf("failed to create docker client: %w", err)
+		}
+		// inspecting a container accepts either its name or its id
+		providers = append(providers, docker.NPIDContext(context.Background(), cli, s.docker))
+	}
+	switch len(providers) {
+	case 0:
+		return neslink.NPNow(), nil
+	case 1:
+		return providers[0], nil
+	default:
+		return neslink.NsProvider{}, fmt.Errorf("%w: only one of -netns, -path, -pid and -docker may be given", errUsage)
+	}
+}
+
+// do performs the actions in the selected netns.
+func (s selector) do(actions ...neslink.Action) error {
+	nsP, err := s.provider()
+	if err != nil {
+		return err
+	}
+	return neslink.Do(nsP, actions...)
+}
+
+// linkInfo describes a link for output.
+type linkInfo struct {
+	Index        int      `json:"index"`
+	Name         string   `json:"name"`
+	Type         string   `json:"type"`
+	State        string   `json:"state"`
+	Up           bool     `json:"up"`
+	MTU          int      `json:"mtu"`
+	HardwareAddr string   `json:"hardwareAddr,omitempty"`
+	Alias        string   `json:"alias,omitempty"`
+	Master       string   `json:"master,omitempty"`
+	Addrs        []string `json:"addrs"`
+}
+
+type linkInfos []linkInfo
+
+func (li linkInfos) String() string {
+	rows := make([][]string, 0, len(li))
+	for _, l := range li {
+		state := l.State
+		if l.Up && state != "up" {
+			state = "up (" + state + ")"
+		}
+		master := ""
+		if l.Master != "" {
+			master = "master " + l.Master
+		}
+		rows = append(rows, []string{
+			strconv.Itoa(l.Index) + ":",
+			l.Name,
+			l.Type,
+			state,
+			"mtu " + strconv.Itoa(l.MTU),
+			l.HardwareAddr,
+			master,
+			strings.Join(l.Addrs, " "),
+		})
+	}
+	return table(rows)
+}
+
+// links lists the links in the selected netns along with their addresses.
+func links(sel selector) (result, error) {
+	var links []netlink.Link
+	var addrs []netlink.Addr
+	if err := sel.do(
+		neslink.NALinks(&links),
+		neslink.NAAddrs(netlink.FAMILY_ALL, &addrs),
+	); err != nil {
+		return nil, err
+	}
+	return linkInfoFor(links, addrs), nil
+}
+
+// linkInfoFor converts the links and addresses into their output form.
+func linkInfoFor(links []netlink.Link, addrs []netlink.Addr) linkInfos {
+	names := make(map[int]string, len(links))
+	for _, l := range links {
+		names[l.Attrs().Index] = l.Attrs().Name
+	}
+	infos := make(linkInfos, 0, len(links))
+	for _, l := range links {
+		attrs := l.Attrs()
+		info := linkInfo{
+			Index:        attrs.Index,
+			Name:         attrs.Name,
+			Type:         l.Type(),
+			State:        attrs.OperState.String(),
+			Up:           attrs.Flags&net.FlagUp != 0,
+			MTU:          attrs.MTU,
+			HardwareAddr: attrs.HardwareAddr.String(),
+			Alias:        attrs.Alias,
+			Master:       names[attrs.MasterIndex],
+			Addrs:        []string{},
+		}
+		for _, a := range addrs {
+			if a.LinkIndex == attrs.Index {
+				info.Addrs = append(info.Addrs, a.IPNet.String())
+			}
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Index < infos[j].Index })
+	return infos
+}
+
+// addrInfo describes an address for output.
+type addrInfo struct {
+	Link  string `json:"link"`
+	Addr  string `json:"addr"`
+	Scope string `json:"scope"`
+	Label string `json:"label,omitempty"`
+}
+
+type addrInfos []addrInfo
+
+func (ai addrInfos) String() string {
+	rows := make([][]string, 0, len(ai))
+	for _, a := range ai {
+		rows = append(rows, []string{a.Link, a.Addr, "scope " + a.Scope, a.Label})
+	}
+	return table(rows)
+}
+
+// addrCommand performs the addr subcommands.
+func addrCommand(sel selector, args []string) (result, error) {
+	sub, args, err := subcommand("addr", args)
+	if err != nil {
+		return nil, err
+	}
+	switch sub {
+	case "list":
+		if len(args) > 1 {
+			return nil, fmt.Errorf("%w: addr list takes at most one link", errUsage)
+		}
+		var links []netlink.Link
+		var addrs []netlink.Addr
+		if err := sel.do(neslink.NALinks(&links), neslink.NAAddrs(netlink.FAMILY_ALL, &addrs)); err != nil {
+			return nil, err
+		}
+		infos := addrInfos{}
+		for _, l := range linkInfoFor(links, nil) {
+			if len(args) == 1 && l.Name != args[0] {
+				continue
+			}
+			for _, a := range addrs {
+				if a.LinkIndex == l.Index {
+					infos = append(infos, addrInfo{
+						Link:  l.Name,
+						Addr:  a.IPNet.String(),
+						Scope: netlink.Scope(a.Scope).String(),
+						Label: a.Label,
+					})
+				}
+			}
+		}
+		return infos, nil
+	case "add", "del":
+		if len(args) < 2 {
+			return nil, fmt.Errorf("%w: addr %s requires a link and at least one cidr", errUsage, sub)
+		}
+		link := neslink.LPName(args[0])
+		actions := make([]neslink.Action, 0, len(args)-1)
+		for _, cidr := range args[1:] {
+			if sub == "add" {
+				actions = append(actions, neslink.LAAddAddr(link, cidr))
+			} else {
+				actions = append(actions, neslink.LADelAddr(link, cidr))
+			}
+		}
+		return nil, sel.do(actions...)
+	default:
+		return nil, fmt.Errorf("%w: unknown addr subcommand %q", errUsage, sub)
+	}
+}
+
+// linkCommand performs the link subcommands.
+func linkCommand(sel selector, args []string) (result, error) {
+	sub, args, err := subcommand("link", args)
+	if err != nil {
+		return nil, err
+	}
+	switch sub {
+	case "add":
+		if len(args) < 2 {
+			return nil, fmt.Errorf("%w: link add requires a type and a name", errUsage)
+		}
+		switch {
+		case args[0] == "bridge" && len(args) == 2:
+			return nil, sel.do(neslink.LANewBridge(args[1]))
+		case args[0] == "dummy" && len(args) == 2:
+			return nil, sel.do(neslink.LANewDummy(args[1]))
+		case args[0] == "veth" && len(args) == 3:
+			return nil, sel.do(neslink.LANewVeth(args[1], args[2]))
+		default:
+			return nil, fmt.Errorf("%w: unsupported link type or arguments for link add %s", errUsage, args[0])
+		}
+	case "del":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%w: link del requires a link", errUsage)
+		}
+		return nil, sel.do(neslink.LADelete(neslink.LPName(args[0])))
+	case "set":
+		if len(args) < 2 {
+			return nil, fmt.Errorf("%w: link set requires a link and at least one setting", errUsage)
+		}
+		actions, err := linkSetActions(neslink.LPName(args[0]), args[1:])
+		if err != nil {
+			return nil, err
+		}
+		return nil, sel.do(actions...)
+	default:
+		return nil, fmt.Errorf("%w: unknown link subcommand %q", errUsage, sub)
+	}
+}
+
+// linkSetActions parses the settings given to link set into actions. Since
+// the link may be renamed, each action after a rename uses the new name.
+func linkSetActions(link neslink.LinkProvider, settings []string) ([]neslink.Action, error) {
+	actions := []neslink.Action{}
+	for idx := 0; idx < len(settings); idx++ {
+		value := func() (string, error) {
+			if idx+1 >= len(settings) {
+				return "", fmt.Errorf("%w: link set %s requires a value", errUsage, settings[idx])
+			}
+			idx++
+			return settings[idx], nil
+		}
+		switch setting := settings[idx]; setting {
+		case "up":
+			actions = append(actions, neslink.LASetUp(link))
+		case "down":
+			actions = append(actions, neslink.LASetDown(link))
+		case "nomaster":
+			actions = append(actions, neslink.LASetNoMaster(link))
+		case "mtu", "name", "alias", "address", "master":
+			v, err := value()
+			if err != nil {
+				return nil, err
+			}
+			switch setting {
+			case "mtu":
+				mtu, err := strconv.Atoi(v)
+				if err != nil {
+					return nil, fmt.Errorf("%w: invalid mtu %q", errUsage, v)
+				}
+				actions = append(actions, neslink.LASetMTU(link, mtu))
+			case "name":
+				actions = append(actions, neslink.LASetName(link, v))
+				link = neslink.LPName(v)
+			case "alias":
+				actions = append(actions, neslink.LASetAlias(link, v))
+			case "address":
+				actions = append(actions, neslink.LASetHw(link, v))
+			case "master":
+				actions = append(actions, neslink.LASetMaster(link, neslink.LPName(v)))
+			}
+		default:
+			return nil, fmt.Errorf("%w: unknown link setting %q", errUsage, setting)
+		}
+	}
+	return actions, nil
+}
+
+// nsInfo describes a netns for output.
+type nsInfo struct {
+	ID    string   `json:"id"`
+	Names []string `json:"names"`
+	Paths []string `json:"paths"`
+	Pids  []int    `json:"pids"`
+}
+
+type nsInfos []nsInfo
+
+func (ni nsInfos) String() string {
+	rows := make([][]string, 0, len(ni))
+	for _, ns := range ni {
+		// only the first few pids are shown, as the root netns has most
+		pids := make([]string, 0, len(ns.Pids))
+		for idx, pid := range ns.Pids {
+			if idx == 8 {
+				pids = append(pids, fmt.Sprintf("(+%d)", len(ns.Pids)-idx))
+				break
+			}
+			pids = append(pids, strconv.Itoa(pid))
+		}
+		names := strings.Join(ns.Names, ",")
+		if names == "" {
+			names = "-"
+		}
+		pidList := strings.Join(pids, ",")
+		if pidList == "" {
+			pidList = "-"
+		}
+		rows = append(rows, []string{ns.ID, names, "pids " + pidList})
+	}
+	return table(rows)
+}
+
+// nsCommand performs the ns subcommands. These ignore the netns selection
+// flags, other than the mount dir.
+func nsCommand(sel selector, args []string) (result, error) {
+	sub, args, err := subcommand("ns", args)
+	if err != nil {
+		return nil, err
+	}
+	switch sub {
+	case "add", "del":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%w: ns %s requires a name", errUsage, sub)
+		}
+		if sub == "add" {
+			return nil, neslink.Do(neslink.NPNow(), neslink.NANewNsAt(sel.mountdir, args[0]))
+		}
+		return nil, neslink.Do(neslink.NPNow(), neslink.NADeleteNamedAt(sel.mountdir, args[0]))
+	case "list":
+		if len(args) != 0 {
+			return nil, fmt.Errorf("%w: ns list takes no arguments", errUsage)
+		}
+		namespaces, err := neslink.ListNamespaces(sel.mountdir)
+		if err != nil {
+			return nil, err
+		}
+		infos := make(nsInfos, 0, len(namespaces))
+		for _, ns := range namespaces {
+			info := nsInfo{
+				ID:    ns.ID.String(),
+				Names: ns.Names,
+				Paths: ns.Paths,
+				Pids:  ns.Pids,
+			}
+			if info.Names == nil {
+				info.Names = []string{}
+			}
+			if info.Paths == nil {
+				info.Paths = []string{}
+			}
+			if info.Pids == nil {
+				info.Pids = []int{}
+			}
+			sort.Ints(info.Pids)
+			infos = append(infos, info)
+		}
+		return infos, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown ns subcommand %q", errUsage, sub)
+	}
+}
+
+// execCommand runs the command in the selected netns, connected to neslink's
+// stdio. The command is started from the thread that Do moves to the netns, so
+// it inherits the netns, but is waited on after Do returns.
+func execCommand(sel selector, args []string) error {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := sel.do(neslink.NAGeneric("exec", cmd.Start)); err != nil {
+		return err
+	}
+	if err := cmd.Wait(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+			return exitCodeError(exitErr.ExitCode())
+		}
+		return fmt.Errorf("failed to run %s: %w", path.Base(args[0]), err)
+	}
+	return nil
+}
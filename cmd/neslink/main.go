@@ -0,0 +1,189 @@
+// Command neslink exposes neslink's providers and actions on the command line,
+// performing each command in a selected network namespace. For example:
+//
+//	neslink ns add red
+//	neslink -netns red link add bridge br0
+//	neslink -netns red link set br0 up mtu 9000
+//	neslink -netns red addr add br0 10.0.0.1/24
+//	neslink -netns red -json links
+//	neslink -docker web exec -- ip route
+//
+// The namespace can be selected by name (-netns), path (-path), pid (-pid) or
+// docker container (-docker), defaulting to the namespace neslink is run in.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const usage string = `usage: neslink [flags] <command> [args]
+
+commands:
+  links                                  list links and their addresses
+  addr list [link]                       list addresses
+  addr add <link> <cidr>...              add addresses to a link
+  addr del <link> <cidr>...              remove addresses from a link
+  link add bridge <name>                 create a bridge
+  link add dummy <name>                  create a dummy link
+  link add veth <name> <peer>            create a veth pair
+  link del <link>                        delete a link
+  link set <link> <setting>...           change a link, where settings are:
+                                           up, down, mtu <n>, name <name>,
+                                           alias <alias>, address <mac>,
+                                           master <link>, nomaster
+  ns add <name>                          create a named netns
+  ns del <name>                          delete a named netns
+  ns list                                list all netns
+  exec -- <command> [args]               run a command in the netns
+
+flags:
+`
+
+// errUsage is returned when a command is given the wrong arguments.
+var errUsage error = errors.New("invalid arguments")
+
+func main() {
+	os.Exit(cli(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// cli parses the flags in args and performs the command they give, writing the
+// result to stdout and any errors to stderr. The exit code is returned.
+func cli(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("neslink", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	var sel selector
+	var jsonOut bool
+	flags.StringVar(&sel.name, "netns", "", "select a named netns (in the mount dir)")
+	flags.StringVar(&sel.path, "path", "", "select the netns at the given path")
+	flags.IntVar(&sel.pid, "pid", 0, "select the netns of the given process")
+	flags.StringVar(&sel.docker, "docker", "", "select the netns of the given docker container (name or id)")
+	flags.StringVar(&sel.mountdir, "mountdir", "/run/netns", "directory that named netns are mounted in")
+	flags.BoolVar(&jsonOut, "json", false, "output results as json")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	result, err := run(sel, flags.Args())
+	if errors.Is(err, errUsage) {
+		fmt.Fprintf(stderr, "neslink: %v\n\n", err)
+		flags.Usage()
+		return 2
+	}
+	var exitErr exitCodeError
+	if errors.As(err, &exitErr) {
+		return int(exitErr)
+	}
+	if err != nil {
+		if jsonOut {
+			json.NewEncoder(stderr).Encode(map[string]string{"error": err.Error()})
+		} else {
+			fmt.Fprintf(stderr, "neslink: %v\n", err)
+		}
+		return 1
+	}
+	if result == nil {
+		return 0
+	}
+	if jsonOut {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			fmt.Fprintf(stderr, "neslink: failed to encode output: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	fmt.Fprint(stdout, result.String())
+	return 0
+}
+
+// run performs the command given by the args in the selected netns, returning
+// a result to output (if any).
+func run(sel selector, args []string) (result, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%w: no command given", errUsage)
+	}
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "links":
+		if len(args) != 0 {
+			return nil, fmt.Errorf("%w: links takes no arguments", errUsage)
+		}
+		return links(sel)
+	case "addr":
+		return addrCommand(sel, args)
+	case "link":
+		return linkCommand(sel, args)
+	case "ns":
+		return nsCommand(sel, args)
+	case "exec":
+		if len(args) > 0 && args[0] == "--" {
+			args = args[1:]
+		}
+		if len(args) == 0 {
+			return nil, fmt.Errorf("%w: exec requires a command", errUsage)
+		}
+		return nil, execCommand(sel, args)
+	default:
+		return nil, fmt.Errorf("%w: unknown command %q", errUsage, cmd)
+	}
+}
+
+// subcommand checks the args start with a subcommand, returning it and the
+// remaining args.
+func subcommand(cmd string, args []string) (string, []string, error) {
+	if len(args) == 0 {
+		return "", nil, fmt.Errorf("%w: %s requires a subcommand", errUsage, cmd)
+	}
+	return args[0], args[1:], nil
+}
+
+// result is the output of a command, which can be printed as text or encoded
+// as json.
+type result interface {
+	String() string
+}
+
+// exitCodeError is returned by exec when the command exits with a non-zero
+// code, which neslink exits with too.
+type exitCodeError int
+
+func (e exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+// table formats rows of columns as aligned text.
+func table(rows [][]string) string {
+	widths := []int{}
+	for _, row := range rows {
+		for idx, col := range row {
+			if idx >= len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[idx] = max(widths[idx], len(col))
+		}
+	}
+	var b strings.Builder
+	for _, row := range rows {
+		var line strings.Builder
+		for idx, col := range row {
+			fmt.Fprintf(&line, "%-*s  ", widths[idx], col)
+		}
+		b.WriteString(strings.TrimRight(line.String(), " "))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
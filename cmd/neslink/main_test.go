@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/willfantom/neslink"
+	"github.com/willfantom/neslink/fake"
+)
+
+// dockerAPI serves a docker api with a single running container, recording
+// the paths requested.
+func dockerAPI(t *testing.T, paths *[]string) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*paths = append(*paths, r.URL.Path)
+		w.Header().Set("Api-Version", "1.41")
+		if strings.HasSuffix(r.URL.Path, "/_ping") {
+			w.Write([]byte("OK"))
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/containers/web/json") {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"Id": "abc123", "State": {"Running": true, "Pid": %d}}`, os.Getpid())
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("DOCKER_HOST", "tcp://"+srv.Listener.Addr().String())
+}
+
+func TestSelector(t *testing.T) {
+	tests := []struct {
+		name    string
+		sel     selector
+		want    neslink.Namespace
+		wantErr bool
+	}{
+		{name: "name", sel: selector{name: "red", mountdir: "/run/netns"}, want: "/run/netns/red"},
+		{name: "name in mountdir", sel: selector{name: "red", mountdir: "/tmp/netns"}, want: "/tmp/netns/red"},
+		{name: "path", sel: selector{path: "/proc/1/ns/net"}, want: "/proc/1/ns/net"},
+		{name: "pid", sel: selector{pid: 1}, want: "/proc/1/ns/net"},
+		{name: "docker", sel: selector{docker: "web"}, want: neslink.Namespace(fmt.Sprintf("/proc/%d/ns/net", os.Getpid()))},
+		{name: "name and path", sel: selector{name: "red", path: "/proc/1/ns/net"}, wantErr: true},
+		{name: "pid and docker", sel: selector{pid: 1, docker: "web"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var paths []string
+			dockerAPI(t, &paths)
+			nsP, err := tt.sel.provider()
+			if tt.wantErr {
+				if !errors.Is(err, errUsage) {
+					t.Fatalf("expected a usage error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			ns, err := nsP.Provide()
+			if err != nil {
+				t.Fatalf("failed to provide netns: %v", err)
+			}
+			if ns != tt.want {
+				t.Errorf("expected netns %s, got %s", tt.want, ns)
+			}
+			if tt.sel.docker != "" && !strings.HasSuffix(paths[len(paths)-1], "/containers/"+tt.sel.docker+"/json") {
+				t.Errorf("expected the container to be inspected, got requests %v", paths)
+			}
+		})
+	}
+}
+
+func TestCLI(t *testing.T) {
+	prev := neslink.SetBackend(fake.New())
+	t.Cleanup(func() { neslink.SetBackend(prev) })
+
+	// each step is run in order against the same fake backend
+	steps := []struct {
+		args     []string
+		code     int
+		stdout   string
+		stderr   string
+		jsonLink *linkInfo
+	}{
+		{args: []string{"ns", "add", "red"}},
+		{args: []string{"-netns", "red", "link", "add", "bridge", "br0"}},
+		{args: []string{"-netns", "red", "link", "set", "br0", "up", "mtu", "9000", "alias", "lan"}},
+		{args: []string{"-netns", "red", "addr", "add", "br0", "10.0.0.1/24"}},
+		{args: []string{"-netns", "red", "links"}, stdout: "br0"},
+		{args: []string{"-netns", "red", "-json", "links"}, jsonLink: &linkInfo{Name: "br0", Type: "bridge", Up: true, MTU: 9000, Alias: "lan", Addrs: []string{"10.0.0.1/24"}}},
+		{args: []string{"-netns", "red", "addr", "list", "br0"}, stdout: "10.0.0.1/24"},
+		{args: []string{"-netns", "red", "link", "set", "br0", "mtu"}, code: 2, stderr: "requires a value"},
+		{args: []string{"-netns", "red", "link", "set", "br0", "mtu", "big"}, code: 2, stderr: "invalid mtu"},
+		{args: []string{"-netns", "red", "-path", "/proc/1/ns/net", "links"}, code: 2, stderr: "only one of"},
+		{args: []string{"-netns", "red", "bogus"}, code: 2, stderr: "unknown command"},
+		{args: []string{"-bogus"}, code: 2},
+		{args: []string{"-netns", "red", "link", "del", "nope"}, code: 1, stderr: "neslink: "},
+		{args: []string{"-json", "-netns", "red", "link", "del", "nope"}, code: 1, stderr: `"error":`},
+		{args: []string{"-netns", "red", "link", "del", "br0"}},
+		{args: []string{"ns", "del", "red"}},
+		{args: []string{"-netns", "red", "links"}, code: 1},
+	}
+	for _, step := range steps {
+		t.Run(strings.Join(step.args, " "), func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := cli(step.args, &stdout, &stderr); code != step.code {
+				t.Fatalf("expected exit code %d, got %d (stderr: %s)", step.code, code, stderr.String())
+			}
+			if !strings.Contains(stdout.String(), step.stdout) {
+				t.Errorf("expected stdout to contain %q, got %q", step.stdout, stdout.String())
+			}
+			if !strings.Contains(stderr.String(), step.stderr) {
+				t.Errorf("expected stderr to contain %q, got %q", step.stderr, stderr.String())
+			}
+			if step.jsonLink == nil {
+				return
+			}
+			var infos []linkInfo
+			if err := json.Unmarshal(stdout.Bytes(), &infos); err != nil {
+				t.Fatalf("failed to decode output: %v", err)
+			}
+			for _, info := range infos {
+				if info.Name != step.jsonLink.Name {
+					continue
+				}
+				want := *step.jsonLink
+				want.Index, want.State, want.HardwareAddr = info.Index, info.State, info.HardwareAddr
+				if fmt.Sprint(info) != fmt.Sprint(want) {
+					t.Errorf("expected link %+v, got %+v", want, info)
+				}
+				return
+			}
+			t.Errorf("link %s not found in output %s", step.jsonLink.Name, stdout.String())
+		})
+	}
+}
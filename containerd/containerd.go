@@ -0,0 +1,48 @@
+package containerd
+
+import (
+	"context"
+	"fmt"
+
+	tasks "github.com/containerd/containerd/api/services/tasks/v1"
+	"github.com/willfantom/neslink"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// DefaultSocket is the default path of the containerd grpc socket.
+	DefaultSocket string = "/run/containerd/containerd.sock"
+
+	// namespaceHeader is the grpc metadata key containerd reads the namespace
+	// of a request from.
+	namespaceHeader string = "containerd-namespace"
+)
+
+// NPTask returns a netns provider that provides the netns path for the task
+// of the container with the given id, in the given containerd namespace (such
+// as "default" or "k8s.io"). The connection should be to a containerd grpc
+// socket, such as one dialled to "unix://" + DefaultSocket.
+func NPTask(conn *grpc.ClientConn, namespace, id string) neslink.NsProvider {
+	return NPTaskContext(context.Background(), conn, namespace, id)
+}
+
+// NPTaskContext returns a netns provider that provides the netns path for the
+// task of the container with the given id, in the given containerd namespace.
+// The given context is used for all requests made to containerd.
+func NPTaskContext(ctx context.Context, conn *grpc.ClientConn, namespace, id string) neslink.NsProvider {
+	return neslink.NPGeneric(
+		"containerd-task",
+		func() (neslink.Namespace, error) {
+			nsCtx := metadata.AppendToOutgoingContext(ctx, namespaceHeader, namespace)
+			resp, err := tasks.NewTasksClient(conn).Get(nsCtx, &tasks.GetRequest{ContainerID: id})
+			if err != nil {
+				return neslink.Namespace(""), fmt.Errorf("failed to get task information:  %w", err)
+			}
+			if resp.Process == nil || resp.Process.Pid == 0 {
+				return neslink.Namespace(""), fmt.Errorf("task for container %s in namespace %s has no process", id, namespace)
+			}
+			return neslink.NPProcess(int(resp.Process.Pid)).Provide()
+		},
+	)
+}
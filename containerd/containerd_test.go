@@ -0,0 +1,107 @@
+package containerd
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	tasks "github.com/containerd/containerd/api/services/tasks/v1"
+	"github.com/containerd/containerd/api/types/task"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeTasks is a tasks service holding the pids of tasks by containerd
+// namespace and container id.
+type fakeTasks struct {
+	tasks.UnimplementedTasksServer
+	pids map[string]map[string]uint32
+}
+
+func (f *fakeTasks) Get(ctx context.Context, req *tasks.GetRequest) (*tasks.GetResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	namespaces := md.Get(namespaceHeader)
+	if len(namespaces) != 1 {
+		return nil, status.Errorf(codes.FailedPrecondition, "expected one namespace, got %v", namespaces)
+	}
+	pid, ok := f.pids[namespaces[0]][req.ContainerID]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "container %s not found in %s", req.ContainerID, namespaces[0])
+	}
+	return &tasks.GetResponse{Process: &task.Process{ID: req.ContainerID, Pid: pid}}, nil
+}
+
+// dialFake serves the given tasks service over an in-memory connection.
+func dialFake(t *testing.T, srv tasks.TasksServer) *grpc.ClientConn {
+	t.Helper()
+	l := bufconn.Listen(1 << 16)
+	s := grpc.NewServer()
+	tasks.RegisterTasksServer(s, srv)
+	go s.Serve(l)
+	t.Cleanup(s.Stop)
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return l.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial fake containerd: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestNPTask(t *testing.T) {
+	conn := dialFake(t, &fakeTasks{pids: map[string]map[string]uint32{
+		"default": {"web": 42},
+		"k8s.io":  {"web": 43, "pause": 0},
+	}})
+
+	tests := []struct {
+		name      string
+		namespace string
+		id        string
+		want      string
+		wantErr   bool
+	}{
+		{name: "default namespace", namespace: "default", id: "web", want: "/proc/42/ns/net"},
+		{name: "other namespace", namespace: "k8s.io", id: "web", want: "/proc/43/ns/net"},
+		{name: "wrong namespace", namespace: "moby", id: "web", wantErr: true},
+		{name: "unknown container", namespace: "default", id: "db", wantErr: true},
+		{name: "no process", namespace: "k8s.io", id: "pause", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ns, err := NPTask(conn, tt.namespace, tt.id).Provide()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got netns %s", ns)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ns.String() != tt.want {
+				t.Errorf("expected netns %s, got %s", tt.want, ns)
+			}
+		})
+	}
+}
+
+func TestNPTaskContext(t *testing.T) {
+	conn := dialFake(t, &fakeTasks{pids: map[string]map[string]uint32{
+		"default": {"web": 42},
+	}})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	cancel()
+	if ns, err := NPTaskContext(ctx, conn, "default", "web").Provide(); err == nil {
+		t.Fatalf("expected an error with a cancelled context, got netns %s", ns)
+	}
+}
@@ -0,0 +1,121 @@
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/willfantom/neslink"
+	"google.golang.org/grpc"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+const (
+	// DefaultContainerdSocket is the default path of the CRI socket provided
+	// by containerd.
+	DefaultContainerdSocket string = "/run/containerd/containerd.sock"
+
+	// DefaultCRIOSocket is the default path of the CRI socket provided by
+	// CRI-O.
+	DefaultCRIOSocket string = "/var/run/crio/crio.sock"
+
+	podNameLabel      string = "io.kubernetes.pod.name"
+	podNamespaceLabel string = "io.kubernetes.pod.namespace"
+)
+
+// sandboxInfo is the subset of the verbose sandbox status info that is used to
+// find the netns of a sandbox. Both containerd and CRI-O provide this as JSON
+// under the "info" key.
+type sandboxInfo struct {
+	Pid         int `json:"pid"`
+	RuntimeSpec struct {
+		Linux struct {
+			Namespaces []struct {
+				Type string `json:"type"`
+				Path string `json:"path"`
+			} `json:"namespaces"`
+		} `json:"linux"`
+	} `json:"runtimeSpec"`
+}
+
+// NPPod returns a netns provider that provides the netns path of the ready
+// sandbox for the kubernetes pod with the given name and namespace. The
+// connection should be to a CRI grpc socket, such as one dialled to "unix://"
+// + DefaultContainerdSocket.
+func NPPod(conn *grpc.ClientConn, namespace, name string) neslink.NsProvider {
+	return NPPodContext(context.Background(), conn, namespace, name)
+}
+
+// NPPodContext returns a netns provider that provides the netns path of the
+// ready sandbox for the kubernetes pod with the given name and namespace. The
+// given context is used for all requests made over the CRI.
+func NPPodContext(ctx context.Context, conn *grpc.ClientConn, namespace, name string) neslink.NsProvider {
+	return neslink.NPGeneric(
+		"cri-pod",
+		func() (neslink.Namespace, error) {
+			client := runtime.NewRuntimeServiceClient(conn)
+			sandboxes, err := client.ListPodSandbox(ctx, &runtime.ListPodSandboxRequest{
+				Filter: &runtime.PodSandboxFilter{
+					State: &runtime.PodSandboxStateValue{State: runtime.PodSandboxState_SANDBOX_READY},
+					LabelSelector: map[string]string{
+						podNameLabel:      name,
+						podNamespaceLabel: namespace,
+					},
+				},
+			})
+			if err != nil {
+				return neslink.Namespace(""), fmt.Errorf("failed to get pod sandbox list:  %w", err)
+			}
+			switch len(sandboxes.Items) {
+			case 0:
+				return neslink.Namespace(""), fmt.Errorf("could not find ready sandbox for pod %s/%s", namespace, name)
+			case 1:
+				return NPSandboxContext(ctx, conn, sandboxes.Items[0].Id).Provide()
+			default:
+				return neslink.Namespace(""), fmt.Errorf("more than one ready sandbox found for pod %s/%s", namespace, name)
+			}
+		},
+	)
+}
+
+// NPSandbox returns a netns provider that provides the netns path of the pod
+// sandbox with the given id.
+func NPSandbox(conn *grpc.ClientConn, id string) neslink.NsProvider {
+	return NPSandboxContext(context.Background(), conn, id)
+}
+
+// NPSandboxContext returns a netns provider that provides the netns path of
+// the pod sandbox with the given id. The netns path from the sandbox's runtime
+// spec is preferred, falling back to the netns of the sandbox's process. The
+// given context is used for all requests made over the CRI.
+func NPSandboxContext(ctx context.Context, conn *grpc.ClientConn, id string) neslink.NsProvider {
+	return neslink.NPGeneric(
+		"cri-sandbox",
+		func() (neslink.Namespace, error) {
+			status, err := runtime.NewRuntimeServiceClient(conn).PodSandboxStatus(ctx, &runtime.PodSandboxStatusRequest{
+				PodSandboxId: id,
+				Verbose:      true,
+			})
+			if err != nil {
+				return neslink.Namespace(""), fmt.Errorf("failed to get pod sandbox status:  %w", err)
+			}
+			raw, ok := status.Info["info"]
+			if !ok {
+				return neslink.Namespace(""), fmt.Errorf("pod sandbox %s status has no runtime info", id)
+			}
+			var info sandboxInfo
+			if err := json.Unmarshal([]byte(raw), &info); err != nil {
+				return neslink.Namespace(""), fmt.Errorf("failed to parse pod sandbox runtime info: %w", err)
+			}
+			for _, ns := range info.RuntimeSpec.Linux.Namespaces {
+				if ns.Type == "network" && ns.Path != "" {
+					return neslink.Namespace(ns.Path), nil
+				}
+			}
+			if info.Pid > 0 {
+				return neslink.NPProcess(info.Pid).Provide()
+			}
+			return neslink.Namespace(""), fmt.Errorf("could not find netns of pod sandbox %s", id)
+		},
+	)
+}
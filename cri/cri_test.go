@@ -0,0 +1,186 @@
+package cri
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// fakeSandbox is a pod sandbox known to the fake runtime service, along with
+// the verbose info it reports.
+type fakeSandbox struct {
+	sandbox *runtime.PodSandbox
+	info    map[string]string
+}
+
+// fakeRuntime is a CRI runtime service that serves pod sandboxes.
+type fakeRuntime struct {
+	runtime.UnimplementedRuntimeServiceServer
+	sandboxes []fakeSandbox
+}
+
+func (f *fakeRuntime) ListPodSandbox(ctx context.Context, req *runtime.ListPodSandboxRequest) (*runtime.ListPodSandboxResponse, error) {
+	resp := &runtime.ListPodSandboxResponse{}
+	for _, s := range f.sandboxes {
+		if req.Filter != nil && req.Filter.State != nil && req.Filter.State.State != s.sandbox.State {
+			continue
+		}
+		matches := true
+		for k, v := range req.GetFilter().GetLabelSelector() {
+			if s.sandbox.Labels[k] != v {
+				matches = false
+			}
+		}
+		if matches {
+			resp.Items = append(resp.Items, s.sandbox)
+		}
+	}
+	return resp, nil
+}
+
+func (f *fakeRuntime) PodSandboxStatus(ctx context.Context, req *runtime.PodSandboxStatusRequest) (*runtime.PodSandboxStatusResponse, error) {
+	for _, s := range f.sandboxes {
+		if s.sandbox.Id != req.PodSandboxId {
+			continue
+		}
+		resp := &runtime.PodSandboxStatusResponse{
+			Status: &runtime.PodSandboxStatus{Id: s.sandbox.Id, State: s.sandbox.State},
+		}
+		if req.Verbose {
+			resp.Info = s.info
+		}
+		return resp, nil
+	}
+	return nil, status.Errorf(codes.NotFound, "sandbox %s not found", req.PodSandboxId)
+}
+
+// dialFake serves the given runtime service over an in-memory connection.
+func dialFake(t *testing.T, srv runtime.RuntimeServiceServer) *grpc.ClientConn {
+	t.Helper()
+	l := bufconn.Listen(1 << 16)
+	s := grpc.NewServer()
+	runtime.RegisterRuntimeServiceServer(s, srv)
+	go s.Serve(l)
+	t.Cleanup(s.Stop)
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return l.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial fake runtime service: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// pod creates a sandbox of the pod with the given namespace and name.
+func pod(id, namespace, name string, state runtime.PodSandboxState, info string) fakeSandbox {
+	s := fakeSandbox{
+		sandbox: &runtime.PodSandbox{
+			Id:    id,
+			State: state,
+			Labels: map[string]string{
+				podNamespaceLabel: namespace,
+				podNameLabel:      name,
+			},
+		},
+	}
+	if info != "" {
+		s.info = map[string]string{"info": info}
+	}
+	return s
+}
+
+func TestNPSandbox(t *testing.T) {
+	ready := runtime.PodSandboxState_SANDBOX_READY
+	conn := dialFake(t, &fakeRuntime{sandboxes: []fakeSandbox{
+		pod("spec", "default", "a", ready, `{"pid":42,"runtimeSpec":{"linux":{"namespaces":[{"type":"pid"},{"type":"network","path":"/var/run/netns/cni-1234"}]}}}`),
+		pod("pid", "default", "b", ready, `{"pid":42,"runtimeSpec":{"linux":{"namespaces":[{"type":"network"}]}}}`),
+		pod("hostnet", "default", "c", ready, `{"runtimeSpec":{"linux":{"namespaces":[{"type":"pid"}]}}}`),
+		pod("noinfo", "default", "d", ready, ""),
+		pod("badinfo", "default", "e", ready, `{"pid":"42"}`),
+	}})
+
+	tests := []struct {
+		id      string
+		want    string
+		wantErr bool
+	}{
+		{id: "spec", want: "/var/run/netns/cni-1234"},
+		{id: "pid", want: "/proc/42/ns/net"},
+		{id: "hostnet", wantErr: true},
+		{id: "noinfo", wantErr: true},
+		{id: "badinfo", wantErr: true},
+		{id: "missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			ns, err := NPSandbox(conn, tt.id).Provide()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got netns %s", ns)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ns.String() != tt.want {
+				t.Errorf("expected netns %s, got %s", tt.want, ns)
+			}
+		})
+	}
+}
+
+func TestNPPod(t *testing.T) {
+	ready := runtime.PodSandboxState_SANDBOX_READY
+	notReady := runtime.PodSandboxState_SANDBOX_NOTREADY
+	conn := dialFake(t, &fakeRuntime{sandboxes: []fakeSandbox{
+		pod("old", "default", "web", notReady, `{"pid":41}`),
+		pod("new", "default", "web", ready, `{"pid":42}`),
+		pod("other", "kube-system", "web", ready, `{"pid":43}`),
+		pod("dup-1", "default", "dup", ready, `{"pid":44}`),
+		pod("dup-2", "default", "dup", ready, `{"pid":45}`),
+		pod("stopped", "default", "stopped", notReady, `{"pid":46}`),
+	}})
+
+	tests := []struct {
+		name      string
+		namespace string
+		pod       string
+		want      string
+		wantErr   bool
+	}{
+		{name: "ready sandbox", namespace: "default", pod: "web", want: "/proc/42/ns/net"},
+		{name: "pod namespace", namespace: "kube-system", pod: "web", want: "/proc/43/ns/net"},
+		{name: "multiple ready sandboxes", namespace: "default", pod: "dup", wantErr: true},
+		{name: "no ready sandbox", namespace: "default", pod: "stopped", wantErr: true},
+		{name: "unknown pod", namespace: "default", pod: "db", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ns, err := NPPod(conn, tt.namespace, tt.pod).Provide()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got netns %s", ns)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ns.String() != tt.want {
+				t.Errorf("expected netns %s, got %s", tt.want, ns)
+			}
+		})
+	}
+}
@@ -0,0 +1,650 @@
+package neslink
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/vishvananda/netlink"
+)
+
+var (
+	errNotDescribable error = errors.New("no descriptor")
+	errUnknownKind    error = errors.New("unknown kind")
+	errKindRegistered error = errors.New("kind is already registered")
+)
+
+// Descriptor is the serialisable form of an action or provider, being its kind
+// and the parameters it was created with. Descriptors can be encoded as json
+// (e.g. to be logged, persisted or sent to another host) and turned back into
+// actions and providers via BuildAction and the like. The kind of a built-in
+// action or provider is the name of the constructor that created it (such as
+// LASetMTU), and its params are a json array of the arguments given to the
+// constructor. Arguments that are pointers used to output values from an
+// action (such as that of NALinks) are not included, and so are discarded by
+// the built action.
+//
+// Actions and providers that are built from functions (such as NAGeneric or
+// LPWhere) have no descriptor, unless one is given via WithDescriptor, and so
+// neither do those that wrap them. Built-in constructors that can not be
+// described are LAForEach, NAGetNsFd (as the opened fd would be leaked),
+// NAExecNescript, and those of the docker, containerd and cri subpackages, as
+// they require an api client that can not be serialised.
+type Descriptor struct {
+	Kind   string          `json:"kind"`
+	Params json.RawMessage `json:"params,omitempty"`
+	args   []any           // as given to NewDescriptor, encoded when needed
+}
+
+// NewDescriptor creates a descriptor of the given kind with the given
+// arguments. This allows custom actions and providers to be described (via
+// WithDescriptor), where the kind should be registered with a function that
+// decodes the arguments via Args. The arguments are only encoded as params
+// when the descriptor is used (such as when it is encoded as json), so Params
+// is left empty, and any error encoding them is returned at that point.
+func NewDescriptor(kind string, args ...any) Descriptor {
+	return Descriptor{Kind: kind, args: args}
+}
+
+// params returns the params of the descriptor, encoding the arguments given to
+// NewDescriptor if they have not been decoded from json.
+func (d Descriptor) params() (json.RawMessage, error) {
+	if d.Params != nil || len(d.args) == 0 {
+		return d.Params, nil
+	}
+	params, err := json.Marshal(d.args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe %s: %w", d.Kind, err)
+	}
+	return params, nil
+}
+
+// Err returns an error if the descriptor does not describe anything, or if its
+// arguments can not be encoded.
+func (d Descriptor) Err() error {
+	if d.Kind == "" {
+		return errNotDescribable
+	}
+	_, err := d.params()
+	return err
+}
+
+// Args decodes the params of a descriptor created via NewDescriptor into the
+// given pointers, one per argument. An error is returned if the number of
+// arguments does not match, or if any can not be decoded.
+func (d Descriptor) Args(args ...any) error {
+	if d.Kind == "" {
+		return errNotDescribable
+	}
+	raw, err := d.params()
+	if err != nil {
+		return err
+	}
+	params := []json.RawMessage{}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &params); err != nil {
+			return fmt.Errorf("invalid params of %s: %w", d.Kind, err)
+		}
+	}
+	if len(params) != len(args) {
+		return fmt.Errorf("invalid params of %s: expected %d arguments, got %d", d.Kind, len(args), len(params))
+	}
+	for idx, param := range params {
+		dec := json.NewDecoder(bytes.NewReader(param))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(args[idx]); err != nil {
+			return fmt.Errorf("invalid argument %d of %s: %w", idx+1, d.Kind, err)
+		}
+	}
+	return nil
+}
+
+// String returns the descriptor as json.
+func (d Descriptor) String() string {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	return string(b)
+}
+
+// MarshalJSON encodes the descriptor as a json object with a kind and params,
+// returning an error if the descriptor does not describe anything.
+func (d Descriptor) MarshalJSON() ([]byte, error) {
+	if d.Kind == "" {
+		return nil, errNotDescribable
+	}
+	params, err := d.params()
+	if err != nil {
+		return nil, err
+	}
+	type plain Descriptor
+	return json.Marshal(plain{Kind: d.Kind, Params: params})
+}
+
+// UnmarshalJSON decodes the descriptor from a json object with a kind and
+// params, rejecting any other fields.
+func (d *Descriptor) UnmarshalJSON(b []byte) error {
+	type plain Descriptor
+	var p plain
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return fmt.Errorf("invalid descriptor: %w", err)
+	}
+	*d = Descriptor(p)
+	return nil
+}
+
+// Describe returns the descriptor of the given action, or an error if it has
+// none.
+func Describe(action Action) (Descriptor, error) {
+	d := action.descriptor()
+	if err := d.Err(); err != nil {
+		return Descriptor{}, fmt.Errorf("failed to describe action %s: %w", action.name(), err)
+	}
+	return d, nil
+}
+
+// Descriptor returns the descriptor of the link action, which may not describe
+// anything (see Descriptor.Err).
+func (la LinkAction) Descriptor() Descriptor {
+	return la.desc
+}
+
+// WithDescriptor returns a copy of the link action with the given descriptor,
+// allowing custom actions (such as those via LAGeneric) to be described. The
+// kind of the descriptor should be registered via RegisterAction.
+func (la LinkAction) WithDescriptor(d Descriptor) LinkAction {
+	la.desc = d
+	return la
+}
+
+// descriptor returns the descriptor of the link action.
+func (la LinkAction) descriptor() Descriptor {
+	return la.desc
+}
+
+// MarshalJSON encodes the link action as its descriptor.
+func (la LinkAction) MarshalJSON() ([]byte, error) {
+	b, err := la.desc.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe link action %s: %w", la.actionName, err)
+	}
+	return b, nil
+}
+
+// UnmarshalJSON decodes a descriptor, building the link action it describes.
+func (la *LinkAction) UnmarshalJSON(b []byte) error {
+	a, err := unmarshalAction(b)
+	if err != nil {
+		return err
+	}
+	linkAction, ok := a.(LinkAction)
+	if !ok {
+		return fmt.Errorf("action %s is not a link action", a.name())
+	}
+	*la = linkAction
+	return nil
+}
+
+// Descriptor returns the descriptor of the netns action, which may not
+// describe anything (see Descriptor.Err).
+func (nsA NsAction) Descriptor() Descriptor {
+	return nsA.desc
+}
+
+// WithDescriptor returns a copy of the netns action with the given descriptor,
+// allowing custom actions (such as those via NAGeneric) to be described. The
+// kind of the descriptor should be registered via RegisterAction.
+func (nsA NsAction) WithDescriptor(d Descriptor) NsAction {
+	nsA.desc = d
+	return nsA
+}
+
+// descriptor returns the descriptor of the netns action.
+func (nsA NsAction) descriptor() Descriptor {
+	return nsA.desc
+}
+
+// MarshalJSON encodes the netns action as its descriptor.
+func (nsA NsAction) MarshalJSON() ([]byte, error) {
+	b, err := nsA.desc.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe netns action %s: %w", nsA.actionName, err)
+	}
+	return b, nil
+}
+
+// UnmarshalJSON decodes a descriptor, building the netns action it describes.
+func (nsA *NsAction) UnmarshalJSON(b []byte) error {
+	a, err := unmarshalAction(b)
+	if err != nil {
+		return err
+	}
+	nsAction, ok := a.(NsAction)
+	if !ok {
+		return fmt.Errorf("action %s is not a netns action", a.name())
+	}
+	*nsA = nsAction
+	return nil
+}
+
+// unmarshalAction decodes a descriptor, building the action it describes.
+func unmarshalAction(b []byte) (Action, error) {
+	var d Descriptor
+	if err := json.Unmarshal(b, &d); err != nil {
+		return nil, err
+	}
+	return BuildAction(d)
+}
+
+// Descriptor returns the descriptor of the netns provider, which may not
+// describe anything (see Descriptor.Err).
+func (nsp NsProvider) Descriptor() Descriptor {
+	return nsp.desc
+}
+
+// WithDescriptor returns a copy of the netns provider with the given
+// descriptor, allowing custom providers (such as those via NPGeneric) to be
+// described. The kind of the descriptor should be registered via
+// RegisterNsProvider.
+func (nsp NsProvider) WithDescriptor(d Descriptor) NsProvider {
+	nsp.desc = d
+	return nsp
+}
+
+// MarshalJSON encodes the netns provider as its descriptor.
+func (nsp NsProvider) MarshalJSON() ([]byte, error) {
+	b, err := nsp.desc.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe netns provider %s: %w", nsp.name, err)
+	}
+	return b, nil
+}
+
+// UnmarshalJSON decodes a descriptor, building the netns provider it
+// describes.
+func (nsp *NsProvider) UnmarshalJSON(b []byte) error {
+	var d Descriptor
+	if err := json.Unmarshal(b, &d); err != nil {
+		return err
+	}
+	p, err := BuildNsProvider(d)
+	if err != nil {
+		return err
+	}
+	*nsp = p
+	return nil
+}
+
+// Descriptor returns the descriptor of the link provider, which may not
+// describe anything (see Descriptor.Err).
+func (lp LinkProvider) Descriptor() Descriptor {
+	return lp.desc
+}
+
+// WithDescriptor returns a copy of the link provider with the given
+// descriptor, allowing custom providers to be described. The kind of the
+// descriptor should be registered via RegisterLinkProvider.
+func (lp LinkProvider) WithDescriptor(d Descriptor) LinkProvider {
+	lp.desc = d
+	return lp
+}
+
+// MarshalJSON encodes the link provider as its descriptor.
+func (lp LinkProvider) MarshalJSON() ([]byte, error) {
+	b, err := lp.desc.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe link provider %s: %w", lp.name, err)
+	}
+	return b, nil
+}
+
+// UnmarshalJSON decodes a descriptor, building the link provider it describes.
+func (lp *LinkProvider) UnmarshalJSON(b []byte) error {
+	var d Descriptor
+	if err := json.Unmarshal(b, &d); err != nil {
+		return err
+	}
+	p, err := BuildLinkProvider(d)
+	if err != nil {
+		return err
+	}
+	*lp = p
+	return nil
+}
+
+// Descriptor returns the descriptor of the links provider, which may not
+// describe anything (see Descriptor.Err).
+func (lp LinksProvider) Descriptor() Descriptor {
+	return lp.desc
+}
+
+// WithDescriptor returns a copy of the links provider with the given
+// descriptor, allowing custom providers to be described. The kind of the
+// descriptor should be registered via RegisterLinksProvider.
+func (lp LinksProvider) WithDescriptor(d Descriptor) LinksProvider {
+	lp.desc = d
+	return lp
+}
+
+// MarshalJSON encodes the links provider as its descriptor.
+func (lp LinksProvider) MarshalJSON() ([]byte, error) {
+	b, err := lp.desc.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe links provider %s: %w", lp.name, err)
+	}
+	return b, nil
+}
+
+// UnmarshalJSON decodes a descriptor, building the links provider it
+// describes.
+func (lp *LinksProvider) UnmarshalJSON(b []byte) error {
+	var d Descriptor
+	if err := json.Unmarshal(b, &d); err != nil {
+		return err
+	}
+	p, err := BuildLinksProvider(d)
+	if err != nil {
+		return err
+	}
+	*lp = p
+	return nil
+}
+
+// registry maps the kinds of descriptors to functions that build what they
+// describe.
+type registry[T any] struct {
+	mu       sync.RWMutex
+	what     string
+	builders map[string]func(Descriptor) (T, error)
+}
+
+var (
+	actionKinds        = &registry[Action]{what: "action"}
+	nsProviderKinds    = &registry[NsProvider]{what: "netns provider"}
+	linkProviderKinds  = &registry[LinkProvider]{what: "link provider"}
+	linksProviderKinds = &registry[LinksProvider]{what: "links provider"}
+)
+
+// register adds the builder of the given kind, returning an error if the kind
+// is already registered.
+func (r *registry[T]) register(kind string, build func(Descriptor) (T, error)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.builders == nil {
+		r.builders = make(map[string]func(Descriptor) (T, error))
+	}
+	if _, ok := r.builders[kind]; ok {
+		return fmt.Errorf("%w: %s %s", errKindRegistered, r.what, kind)
+	}
+	r.builders[kind] = build
+	return nil
+}
+
+// build builds what the descriptor describes via the builder of its kind.
+func (r *registry[T]) build(d Descriptor) (T, error) {
+	var zero T
+	if err := d.Err(); err != nil {
+		return zero, fmt.Errorf("failed to build %s: %w", r.what, err)
+	}
+	r.mu.RLock()
+	build, ok := r.builders[d.Kind]
+	r.mu.RUnlock()
+	if !ok {
+		return zero, fmt.Errorf("failed to build %s: %w: %s", r.what, errUnknownKind, d.Kind)
+	}
+	v, err := build(d)
+	if err != nil {
+		return zero, fmt.Errorf("failed to build %s %s: %w", r.what, d.Kind, err)
+	}
+	return v, nil
+}
+
+// RegisterAction registers the function used to build actions of the given
+// kind from their descriptors. An error is returned if the kind is already
+// registered. Custom kinds should be prefixed with the name of their package
+// (e.g. wireguard.LASetListenPort) to avoid conflicts.
+func RegisterAction(kind string, build func(Descriptor) (Action, error)) error {
+	return actionKinds.register(kind, build)
+}
+
+// RegisterNsProvider registers the function used to build netns providers of
+// the given kind from their descriptors. An error is returned if the kind is
+// already registered.
+func RegisterNsProvider(kind string, build func(Descriptor) (NsProvider, error)) error {
+	return nsProviderKinds.register(kind, build)
+}
+
+// RegisterLinkProvider registers the function used to build link providers of
+// the given kind from their descriptors. An error is returned if the kind is
+// already registered.
+func RegisterLinkProvider(kind string, build func(Descriptor) (LinkProvider, error)) error {
+	return linkProviderKinds.register(kind, build)
+}
+
+// RegisterLinksProvider registers the function used to build links providers
+// of the given kind from their descriptors. An error is returned if the kind is
+// already registered.
+func RegisterLinksProvider(kind string, build func(Descriptor) (LinksProvider, error)) error {
+	return linksProviderKinds.register(kind, build)
+}
+
+// BuildAction builds the action described by the given descriptor.
+func BuildAction(d Descriptor) (Action, error) {
+	return actionKinds.build(d)
+}
+
+// BuildNsProvider builds the netns provider described by the given descriptor.
+func BuildNsProvider(d Descriptor) (NsProvider, error) {
+	return nsProviderKinds.build(d)
+}
+
+// BuildLinkProvider builds the link provider described by the given
+// descriptor.
+func BuildLinkProvider(d Descriptor) (LinkProvider, error) {
+	return linkProviderKinds.build(d)
+}
+
+// BuildLinksProvider builds the links provider described by the given
+// descriptor.
+func BuildLinksProvider(d Descriptor) (LinksProvider, error) {
+	return linksProviderKinds.build(d)
+}
+
+// kind0 creates a builder that calls the given constructor.
+func kind0[R any](f func() R) func(Descriptor) (R, error) {
+	return func(d Descriptor) (R, error) {
+		if err := d.Args(); err != nil {
+			var zero R
+			return zero, err
+		}
+		return f(), nil
+	}
+}
+
+// kind1 creates a builder that calls the given constructor with the single
+// argument of a descriptor.
+func kind1[A, R any](f func(A) R) func(Descriptor) (R, error) {
+	return func(d Descriptor) (R, error) {
+		var a A
+		if err := d.Args(&a); err != nil {
+			var zero R
+			return zero, err
+		}
+		return f(a), nil
+	}
+}
+
+// kind2 creates a builder that calls the given constructor with the two
+// arguments of a descriptor.
+func kind2[A, B, R any](f func(A, B) R) func(Descriptor) (R, error) {
+	return func(d Descriptor) (R, error) {
+		var a A
+		var b B
+		if err := d.Args(&a, &b); err != nil {
+			var zero R
+			return zero, err
+		}
+		return f(a, b), nil
+	}
+}
+
+// kind3 creates a builder that calls the given constructor with the three
+// arguments of a descriptor.
+func kind3[A, B, C, R any](f func(A, B, C) R) func(Descriptor) (R, error) {
+	return func(d Descriptor) (R, error) {
+		var a A
+		var b B
+		var c C
+		if err := d.Args(&a, &b, &c); err != nil {
+			var zero R
+			return zero, err
+		}
+		return f(a, b, c), nil
+	}
+}
+
+// asAction converts a builder of a specific type of action into one of actions.
+func asAction[R Action](build func(Descriptor) (R, error)) func(Descriptor) (Action, error) {
+	return func(d Descriptor) (Action, error) {
+		return build(d)
+	}
+}
+
+func init() {
+	actions := map[string]func(Descriptor) (Action, error){
+		"LANewBridge":     asAction(kind1(LANewBridge)),
+		"LANewVeth":       asAction(kind2(LANewVeth)),
+		"LANewVethPeerNs": asAction(kind3(LANewVethPeerNs)),
+		"LANewDummy":      asAction(kind1(LANewDummy)),
+		"LANewGRETap":     asAction(kind3(LANewGRETap)),
+		"LANewTuntap": asAction(kind2(func(name string, config TuntapConfig) LinkAction {
+			return LANewTuntap(name, config, nil)
+		})),
+		"LANewWireguard": asAction(kind1(LANewWireguard)),
+		"LANewVxlan": func(d Descriptor) (Action, error) {
+			var name, localIP, groupIP string
+			var id, port int
+			if err := d.Args(&name, &localIP, &groupIP, &id, &port); err != nil {
+				return nil, err
+			}
+			return LANewVxlan(name, localIP, groupIP, id, port), nil
+		},
+		"LANewGRE":        asAction(kind2(LANewGRE)),
+		"LANewIPIP":       asAction(kind2(LANewIPIP)),
+		"LANewSIT":        asAction(kind2(LANewSIT)),
+		"LANewIP6Tnl":     asAction(kind2(LANewIP6Tnl)),
+		"LANewGeneve":     asAction(kind2(LANewGeneve)),
+		"LADelete":        asAction(kind1(LADelete)),
+		"LASetName":       asAction(kind2(LASetName)),
+		"LASetAlias":      asAction(kind2(LASetAlias)),
+		"LASetHw":         asAction(kind2(LASetHw)),
+		"LASetMTU":        asAction(kind2(LASetMTU)),
+		"LASet":           asAction(kind2(LASet)),
+		"LASetUp":         asAction(kind1(LASetUp)),
+		"LASetDown":       asAction(kind1(LASetDown)),
+		"LASetPromiscOn":  asAction(kind1(LASetPromiscOn)),
+		"LASetPromiscOff": asAction(kind1(LASetPromiscOff)),
+		"LAAddAddr":       asAction(kind2(LAAddAddr)),
+		"LADelAddr":       asAction(kind2(LADelAddr)),
+		"LASetMaster":     asAction(kind2(LASetMaster)),
+		"LASetNoMaster":   asAction(kind1(LASetNoMaster)),
+		"LAAddRoute":      asAction(kind3(LAAddRoute)),
+		"LADelRoute":      asAction(kind3(LADelRoute)),
+		"LAAddAddrConfig": asAction(kind2(LAAddAddrConfig)),
+		"LAReplaceAddr":   asAction(kind2(LAReplaceAddr)),
+		"LAFlushAddrs":    asAction(kind2(LAFlushAddrs)),
+		"LAGetAddrs": asAction(kind2(func(provider LinkProvider, family int) LinkAction {
+			return LAGetAddrs(provider, family, &[]netlink.Addr{})
+		})),
+		"LAWaitExists":       asAction(kind2(LAWaitExists)),
+		"LAWaitOperUp":       asAction(kind2(LAWaitOperUp)),
+		"LAWaitCarrier":      asAction(kind2(LAWaitCarrier)),
+		"LAWaitAddr":         asAction(kind3(LAWaitAddr)),
+		"LAEnsureBridge":     asAction(kind1(LAEnsureBridge)),
+		"LAEnsureDummy":      asAction(kind1(LAEnsureDummy)),
+		"LAEnsureVeth":       asAction(kind2(LAEnsureVeth)),
+		"LAEnsureAddr":       asAction(kind2(LAEnsureAddr)),
+		"LAEnsureAddrConfig": asAction(kind2(LAEnsureAddrConfig)),
+		"LAEnsureRoute":      asAction(kind3(LAEnsureRoute)),
+		"NANewNsAt":          asAction(kind2(NANewNsAt)),
+		"NANewNs":            asAction(kind1(NANewNs)),
+		"NAEnsureNsAt":       asAction(kind2(NAEnsureNsAt)),
+		"NAEnsureNs":         asAction(kind1(NAEnsureNs)),
+		"NASetLinkNs":        asAction(kind2(NASetLinkNs)),
+		"NADeleteNamedAt":    asAction(kind2(NADeleteNamedAt)),
+		"NADeleteNamed":      asAction(kind1(NADeleteNamed)),
+		"NALinks": asAction(kind0(func() NsAction {
+			return NALinks(&[]netlink.Link{})
+		})),
+		"NAAddrs": asAction(kind1(func(family int) NsAction {
+			return NAAddrs(family, &[]netlink.Addr{})
+		})),
+		"NAGetLink": asAction(kind1(func(provider LinkProvider) NsAction {
+			return NAGetLink(provider, new(netlink.Link))
+		})),
+		"NAGetNetNsID": asAction(kind1(func(nsP NsProvider) NsAction {
+			return NAGetNetNsID(nsP, new(int))
+		})),
+		"NASetNetNsID": asAction(kind2(NASetNetNsID)),
+		"NAVethPeer": asAction(kind1(func(lP LinkProvider) NsAction {
+			return NAVethPeer(lP, new(NsProvider), new(LinkProvider))
+		})),
+		"NAAddFou":    asAction(kind1(NAAddFou)),
+		"NADelFou":    asAction(kind1(NADelFou)),
+		"NAWaitRoute": asAction(kind2(NAWaitRoute)),
+	}
+	for kind, build := range actions {
+		RegisterAction(kind, build)
+	}
+
+	nsProviders := map[string]func(Descriptor) (NsProvider, error){
+		"NPNow":     kind0(NPNow),
+		"NPProcess": kind1(NPProcess),
+		"NPThread":  kind2(NPThread),
+		"NPName":    kind1(NPName),
+		"NPNameAt":  kind2(NPNameAt),
+		"NPPath":    kind1(NPPath),
+		"NPNetNsID": kind3(func(origin NsProvider, nsid int, mountdirs []string) NsProvider {
+			return NPNetNsID(origin, nsid, mountdirs...)
+		}),
+		"NPSameAs": kind2(func(nsP NsProvider, mountdirs []string) NsProvider {
+			return NPSameAs(nsP, mountdirs...)
+		}),
+		"NPProcessName": kind1(NPProcessName),
+		"NPCgroup":      kind1(NPCgroup),
+		"NPPidFile":     kind1(NPPidFile),
+		"NPCached":      kind2(NPCached),
+		"NPValidated":   kind1(NPValidated),
+	}
+	for kind, build := range nsProviders {
+		RegisterNsProvider(kind, build)
+	}
+
+	linkProviders := map[string]func(Descriptor) (LinkProvider, error){
+		"LPName":         kind1(LPName),
+		"LPAlias":        kind1(LPAlias),
+		"LPIndex":        kind1(LPIndex),
+		"LPHardwareAddr": kind1(LPHardwareAddr),
+		"LPAltName":      kind1(LPAltName),
+		"LPType":         kind1(LPType),
+		"LPMasterOf":     kind1(LPMasterOf),
+		"LPVethPeer":     kind1(LPVethPeer),
+	}
+	for kind, build := range linkProviders {
+		RegisterLinkProvider(kind, build)
+	}
+
+	linksProviders := map[string]func(Descriptor) (LinksProvider, error){
+		"LPsAll":      kind0(LPsAll),
+		"LPsType":     kind1(LPsType),
+		"LPsMasterOf": kind1(LPsMasterOf),
+	}
+	for kind, build := range linksProviders {
+		RegisterLinksProvider(kind, build)
+	}
+}
@@ -0,0 +1,212 @@
+package neslink_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/willfantom/neslink"
+)
+
+// builtins has a value of every built-in kind that can be described, with
+// arguments set so that their encoding is checked.
+func builtins() []any {
+	br0 := neslink.LPName("br0")
+	red := neslink.NPName("red")
+	scope := netlink.SCOPE_LINK
+	tunnel := neslink.TunnelConfig{
+		Local:    net.ParseIP("10.0.0.1"),
+		Remote:   net.ParseIP("10.0.0.2"),
+		Underlay: &br0,
+		TTL:      64,
+		Encap:    &neslink.TunnelEncap{Type: netlink.FOU_ENCAP_GUE, Dport: 5555, Csum: true},
+	}
+	addr := neslink.AddrConfig{CIDR: "fd00::1/64", Scope: &scope, ValidLft: time.Hour, NoDAD: true, WaitDAD: time.Second}
+	return []any{
+		// link actions
+		neslink.LANewBridge("br0"),
+		neslink.LANewVeth("v0", "v1"),
+		neslink.LANewVethPeerNs(neslink.VethEnd{Name: "v0", MTU: 1400, Addrs: []string{"10.0.0.1/24"}, Up: true}, neslink.VethEnd{Name: "v1", HardwareAddr: "02:00:00:00:00:01"}, red),
+		neslink.LANewDummy("d0"),
+		neslink.LANewGRETap("gt0", "10.0.0.1", "10.0.0.2"),
+		neslink.LANewTuntap("tap0", neslink.TuntapConfig{Mode: netlink.TUNTAP_MODE_TAP, MultiQueue: true, Queues: 2, Persist: true, Owner: 1000}, nil),
+		neslink.LANewWireguard("wg0"),
+		neslink.LANewVxlan("vx0", "10.0.0.1", "239.0.0.1", 42, 4789),
+		neslink.LANewGRE("gre0", neslink.GREConfig{TunnelConfig: tunnel, IKey: 1, OKey: 2}),
+		neslink.LANewIPIP("ipip0", tunnel),
+		neslink.LANewSIT("sit0", tunnel),
+		neslink.LANewIP6Tnl("ip6tnl0", neslink.TunnelConfig{Remote: net.ParseIP("fd00::2"), NoPMTUDisc: true}),
+		neslink.LANewGeneve("gnv0", neslink.GeneveConfig{TunnelConfig: neslink.TunnelConfig{Remote: net.ParseIP("10.0.0.2")}, VNI: 7, Port: 6081}),
+		neslink.LADelete(br0),
+		neslink.LASetName(br0, "br1"),
+		neslink.LASetAlias(br0, "lan"),
+		neslink.LASetHw(br0, "02:00:00:00:00:01"),
+		neslink.LASetMTU(br0, 9000),
+		neslink.LASet(br0, neslink.LinkSettings{MTU: neslink.Ptr(1400), ARP: neslink.Ptr(false), AddAltNames: []string{"lan0"}}),
+		neslink.LASetUp(br0),
+		neslink.LASetDown(br0),
+		neslink.LASetPromiscOn(br0),
+		neslink.LASetPromiscOff(br0),
+		neslink.LAAddAddr(br0, "10.0.0.1/24"),
+		neslink.LADelAddr(br0, "10.0.0.1/24"),
+		neslink.LASetMaster(neslink.LPName("v0"), br0),
+		neslink.LASetNoMaster(neslink.LPName("v0")),
+		neslink.LAAddRoute(br0, "10.1.0.0/16", "10.0.0.254"),
+		neslink.LADelRoute(br0, "", "10.0.0.254"),
+		neslink.LAAddAddrConfig(br0, addr),
+		neslink.LAReplaceAddr(br0, addr),
+		neslink.LAFlushAddrs(br0, netlink.FAMILY_V4),
+		neslink.LAGetAddrs(br0, netlink.FAMILY_ALL, nil),
+		neslink.LAWaitExists(br0, time.Second),
+		neslink.LAWaitOperUp(br0, 0),
+		neslink.LAWaitCarrier(br0, time.Minute),
+		neslink.LAWaitAddr(br0, "fd00::1", 2*time.Second),
+		neslink.LAEnsureBridge("br0"),
+		neslink.LAEnsureDummy("d0"),
+		neslink.LAEnsureVeth("v0", "v1"),
+		neslink.LAEnsureAddr(br0, "10.0.0.1/24"),
+		neslink.LAEnsureAddrConfig(br0, addr),
+		neslink.LAEnsureRoute(br0, "", "10.0.0.254"),
+		// netns actions
+		neslink.NANewNsAt("/tmp/netns", "red"),
+		neslink.NANewNs("red"),
+		neslink.NAEnsureNsAt("/tmp/netns", "red"),
+		neslink.NAEnsureNs("red"),
+		neslink.NASetLinkNs(br0, red),
+		neslink.NADeleteNamedAt("/tmp/netns", "red"),
+		neslink.NADeleteNamed("red"),
+		neslink.NALinks(nil),
+		neslink.NAAddrs(netlink.FAMILY_V6, nil),
+		neslink.NAGetLink(br0, nil),
+		neslink.NAGetNetNsID(red, nil),
+		neslink.NASetNetNsID(red, 5),
+		neslink.NAVethPeer(neslink.LPName("v0"), nil, nil),
+		neslink.NAAddFou(neslink.FouConfig{Port: 5555, GUE: true}),
+		neslink.NADelFou(neslink.FouConfig{Port: 5555, Protocol: 4, IPv6: true}),
+		neslink.NAWaitRoute("10.1.0.0/16", time.Second),
+		// netns providers
+		neslink.NPNow(),
+		neslink.NPProcess(1),
+		neslink.NPThread(1, 2),
+		red,
+		neslink.NPNameAt("/tmp/netns", "red"),
+		neslink.NPPath("/proc/1/ns/net"),
+		neslink.NPNetNsID(red, 5, "/tmp/netns"),
+		neslink.NPSameAs(neslink.NPNow()),
+		neslink.NPProcessName("^nginx$"),
+		neslink.NPCgroup("system.slice/nginx.service"),
+		neslink.NPPidFile("/run/nginx.pid"),
+		neslink.NPCached(red, time.Minute),
+		neslink.NPValidated(neslink.NPProcess(1)),
+		// link providers
+		br0,
+		neslink.LPAlias("lan"),
+		neslink.LPIndex(3),
+		neslink.LPHardwareAddr("02:00:00:00:00:01"),
+		neslink.LPAltName("lan0"),
+		neslink.LPType("bridge"),
+		neslink.LPMasterOf(br0),
+		neslink.LPVethPeer(neslink.LPName("v0")),
+		// links providers
+		neslink.LPsAll(),
+		neslink.LPsType("veth"),
+		neslink.LPsMasterOf(br0),
+	}
+}
+
+// build builds the same type of value as v from the given descriptor.
+func build(v any, d neslink.Descriptor) (any, error) {
+	switch v.(type) {
+	case neslink.NsProvider:
+		return neslink.BuildNsProvider(d)
+	case neslink.LinkProvider:
+		return neslink.BuildLinkProvider(d)
+	case neslink.LinksProvider:
+		return neslink.BuildLinksProvider(d)
+	default:
+		return neslink.BuildAction(d)
+	}
+}
+
+func TestDescriptorRoundTrip(t *testing.T) {
+	seen := map[string]bool{}
+	for _, v := range builtins() {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Errorf("failed to encode %T: %v", v, err)
+			continue
+		}
+		var d neslink.Descriptor
+		if err := json.Unmarshal(b, &d); err != nil {
+			t.Errorf("failed to decode %s: %v", b, err)
+			continue
+		}
+		t.Run(d.Kind, func(t *testing.T) {
+			seen[d.Kind] = true
+			built, err := build(v, d)
+			if err != nil {
+				t.Fatalf("failed to build %s: %v", b, err)
+			}
+			rebuilt, err := json.Marshal(built)
+			if err != nil {
+				t.Fatalf("failed to encode the built %s: %v", d.Kind, err)
+			}
+			if !bytes.Equal(b, rebuilt) {
+				t.Errorf("expected %s, got %s", b, rebuilt)
+			}
+		})
+	}
+	for _, kind := range neslink.RegisteredKinds() {
+		if !seen[kind] {
+			t.Errorf("built-in kind %s is not covered", kind)
+		}
+	}
+}
+
+func TestDescriptorRejected(t *testing.T) {
+	tests := []struct {
+		name  string
+		v     any
+		input string
+		want  string
+	}{
+		{name: "unknown action", v: neslink.LASetUp(neslink.LPName("br0")), input: `{"kind":"LAMissing"}`, want: "unknown kind"},
+		{name: "unknown netns provider", v: neslink.NPNow(), input: `{"kind":"NPMissing"}`, want: "unknown kind"},
+		{name: "unknown link provider", v: neslink.LPName("br0"), input: `{"kind":"LPMissing","params":["br0"]}`, want: "unknown kind"},
+		{name: "unknown links provider", v: neslink.LPsAll(), input: `{"kind":"LPsMissing"}`, want: "unknown kind"},
+		{name: "provider as action", v: neslink.LASetUp(neslink.LPName("br0")), input: `{"kind":"LPName","params":["br0"]}`, want: "unknown kind"},
+		{name: "unknown nested kind", v: neslink.LASetUp(neslink.LPName("br0")), input: `{"kind":"LASetUp","params":[{"kind":"LPMissing"}]}`, want: "unknown kind"},
+		{name: "no kind", v: neslink.NPNow(), input: `{"params":[]}`, want: "no descriptor"},
+		{name: "unknown field", v: neslink.NPNow(), input: `{"kind":"NPNow","extra":1}`, want: "unknown field"},
+		{name: "unknown nested field", v: neslink.LASetUp(neslink.LPName("br0")), input: `{"kind":"LASetUp","params":[{"kind":"LPName","params":["br0"],"extra":1}]}`, want: "unknown field"},
+		{name: "unknown config field", v: neslink.NAAddFou(neslink.FouConfig{}), input: `{"kind":"NAAddFou","params":[{"Port":5555,"Extra":1}]}`, want: "unknown field"},
+		{name: "missing params", v: neslink.LASetMTU(neslink.LPName("br0"), 1500), input: `{"kind":"LASetMTU","params":[{"kind":"LPName","params":["br0"]}]}`, want: "expected 2 arguments"},
+		{name: "extra params", v: neslink.NPNow(), input: `{"kind":"NPNow","params":[1]}`, want: "expected 0 arguments"},
+		{name: "wrong param type", v: neslink.NPProcess(1), input: `{"kind":"NPProcess","params":["one"]}`, want: "invalid argument 1"},
+		{name: "params not an array", v: neslink.NPProcess(1), input: `{"kind":"NPProcess","params":{"pid":1}}`, want: "invalid params"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			switch tt.v.(type) {
+			case neslink.NsProvider:
+				err = json.Unmarshal([]byte(tt.input), new(neslink.NsProvider))
+			case neslink.LinkProvider:
+				err = json.Unmarshal([]byte(tt.input), new(neslink.LinkProvider))
+			case neslink.LinksProvider:
+				err = json.Unmarshal([]byte(tt.input), new(neslink.LinksProvider))
+			case neslink.LinkAction:
+				err = json.Unmarshal([]byte(tt.input), new(neslink.LinkAction))
+			default:
+				err = json.Unmarshal([]byte(tt.input), new(neslink.NsAction))
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -23,28 +23,46 @@ var (
 // move fails or any provided action fails. Do note that if the spawned system
 // thread fails to be reverted to the network namespace of the caller, the
 // thread is considered dirty and is never unlocked (thus can not be reused).
+// To see what a set of actions would do without performing them, see DryRun.
 func Do(nsP NsProvider, actions ...Action) error {
+	return DoReport(nsP, nil, actions...)
+}
+
+// ActionResult is the outcome of a single action performed via DoReport.
+type ActionResult struct {
+	Index int    // position of the action in the list given to DoReport
+	Name  string // name of the action
+	Err   error  // error returned by the action, if any
+}
+
+// DoReport is the same as Do, but calls report with the result of each action
+// as soon as it has been performed. As with Do, no further actions are
+// performed once one fails, so the final report is of either the last action
+// or the one that failed. Note that report is called on the thread moved into
+// the target netns, so should not perform any netns sensitive operations. A
+// nil report is ignored.
+func DoReport(nsP NsProvider, report func(ActionResult), actions ...Action) error {
 	// 1. get origin network namespace fd to revert back to
 	originNs, err := NPNow().Provide()
 	if err != nil {
 		return fmt.Errorf("failed to get origin netns: %w", err)
 	}
-	originNsFd, err := originNs.open()
+	originNsFd, err := backend.OpenNs(originNs)
 	if err != nil {
 		return fmt.Errorf("failed to open the origin netns file descriptor: %w", err)
 	}
-	defer originNsFd.close()
+	defer backend.CloseNs(originNsFd)
 
 	// 2. get new network namespace fd to switch to
 	targetNs, err := nsP.Provide()
 	if err != nil {
 		return fmt.Errorf("failed to get target netns: %w", err)
 	}
-	targetNsFd, err := targetNs.open()
+	targetNsFd, err := backend.OpenNs(targetNs)
 	if err != nil {
 		return fmt.Errorf("failed to open the target netns file descriptor: %w", err)
 	}
-	defer targetNsFd.close()
+	defer backend.CloseNs(targetNsFd)
 
 	// 3. create error channel for new routine
 	errChan := make(chan error, 1)
@@ -54,10 +72,12 @@ func Do(nsP NsProvider, actions ...Action) error {
 	go func(oNs, tNs NsFd, actions ...Action) {
 
 		// 1. lock os thread for goroutine
-		runtime.LockOSThread()
+		backend.LockThread()
 
 		// 2. switch to new netns
-		if err := tNs.set(); err != nil {
+		if err := backend.SetNs(tNs); err != nil {
+			// the thread has not moved, so can be safely released
+			backend.UnlockThread()
 			errChan <- fmt.Errorf("failed to set netns to the target: %w", err)
 			return
 		}
@@ -67,20 +87,24 @@ func Do(nsP NsProvider, actions ...Action) error {
 
 		// 3. exec actions
 		for idx, action := range actions {
-			if err := action.act(); err != nil {
+			err := action.act()
+			if report != nil {
+				report(ActionResult{Index: idx, Name: action.name(), Err: err})
+			}
+			if err != nil {
 				errSet = errors.Join(errSet, fmt.Errorf("failed to perform action %d (%s)", idx+1, action.name()), err)
 				break
 			}
 		}
 
 		// 4. switch to origin netns
-		if err := oNs.set(); err != nil {
+		if err := backend.SetNs(oNs); err != nil {
 			errSet = errors.Join(errSet, fmt.Errorf("failed to switch to origin ns"), err, errDirtyThread)
 		}
 
 		// 5. if thread is dirty, don't unlock thread and sleep routine forever
 		if !errors.Is(errSet, errDirtyThread) {
-			runtime.UnlockOSThread()
+			backend.UnlockThread()
 			errChan <- errSet
 		} else {
 			errChan <- errSet
@@ -94,6 +118,29 @@ func Do(nsP NsProvider, actions ...Action) error {
 	return <-errChan
 }
 
+// inNs performs the given function with the calling thread moved to the netns
+// of the given fd, returning the thread to its original netns afterwards. If
+// the thread can not be returned, the error wraps errDirtyThread.
+func inNs(nsfd NsFd, f func() error) error {
+	now, err := NPNow().Provide()
+	if err != nil {
+		return fmt.Errorf("failed to get current netns: %w", err)
+	}
+	originFd, err := backend.OpenNs(now)
+	if err != nil {
+		return fmt.Errorf("failed to open the current netns file descriptor: %w", err)
+	}
+	defer backend.CloseNs(originFd)
+	if err := backend.SetNs(nsfd); err != nil {
+		return fmt.Errorf("failed to set netns: %w", err)
+	}
+	errSet := f()
+	if err := backend.SetNs(originFd); err != nil {
+		errSet = errors.Join(errSet, fmt.Errorf("failed to switch back to the original netns"), err, errDirtyThread)
+	}
+	return errSet
+}
+
 func init() {
 	runtime.LockOSThread()
 }
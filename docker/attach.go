@@ -0,0 +1,172 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/willfantom/neslink"
+)
+
+// AttachConfig describes an additional interface to be wired into a container.
+// The host end of the veth pair is named HostIfName and the container end is
+// named IfName. If Bridge is set, the host end is attached to the bridge with
+// that name. Addresses should be given in CIDR notation, and if Gateway is set
+// a default route via it is added in the container.
+type AttachConfig struct {
+	HostIfName string
+	IfName     string
+	Bridge     string
+	Addrs      []string
+	Gateway    string
+	MTU        int
+}
+
+// Attachment is an interface that has been wired into a running container via
+// Attach. It is detached automatically when the container stops, or can be
+// detached manually via Detach.
+type Attachment struct {
+	ContainerID string
+	HostIfName  string
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+	err    error
+}
+
+// Attach wires an additional interface into the running container with the
+// given name or id. A veth pair is created on the host, with one end moved to
+// the container's netns, renamed and configured as described by the given
+// config. The host end is set up and attached to the bridge if one is given.
+// When the container stops, the host end is cleaned up (if the kernel has not
+// already removed it) and the attachment is marked as done.
+func Attach(ctx context.Context, cli *client.Client, container string, config AttachConfig) (*Attachment, error) {
+	if config.HostIfName == "" || config.IfName == "" {
+		return nil, fmt.Errorf("both the host and container interface names are required")
+	}
+	c, err := cli.ContainerInspect(ctx, container)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get container infomation:  %w", err)
+	}
+	if c.State == nil || !c.State.Running {
+		return nil, fmt.Errorf("%w: %s", errContainerNotRunning, container)
+	}
+
+	// 1. watch for the container stopping before anything is created
+	watchCtx, cancel := context.WithCancel(context.Background())
+	msgs, errs := cli.Events(watchCtx, types.EventsOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("type", "container"),
+			filters.Arg("container", c.ID),
+			filters.Arg("event", "die"),
+		),
+	})
+	a := &Attachment{
+		ContainerID: c.ID,
+		HostIfName:  config.HostIfName,
+		cancel:      cancel,
+		done:        make(chan struct{}),
+	}
+
+	// 2. create the pair on the host and move the container end over
+	tmpName := "nl" + c.ID[:12]
+	containerNs := NPIDContext(ctx, cli, c.ID)
+	hostActions := []neslink.Action{
+		neslink.LANewVeth(config.HostIfName, tmpName),
+	}
+	if config.MTU > 0 {
+		hostActions = append(hostActions, neslink.LASetMTU(neslink.LPName(config.HostIfName), config.MTU))
+	}
+	if config.Bridge != "" {
+		hostActions = append(hostActions, neslink.LASetMaster(neslink.LPName(config.HostIfName), neslink.LPName(config.Bridge)))
+	}
+	hostActions = append(hostActions,
+		neslink.LASetUp(neslink.LPName(config.HostIfName)),
+		neslink.NASetLinkNs(neslink.LPName(tmpName), containerNs),
+	)
+	if err := neslink.Do(neslink.NPNow(), hostActions...); err != nil {
+		cancel()
+		return nil, errors.Join(fmt.Errorf("failed to create interface for container"), err, a.deleteHostLink())
+	}
+
+	// 3. configure the container end
+	containerActions := []neslink.Action{
+		neslink.LASetName(neslink.LPName(tmpName), config.IfName),
+	}
+	if config.MTU > 0 {
+		containerActions = append(containerActions, neslink.LASetMTU(neslink.LPName(config.IfName), config.MTU))
+	}
+	for _, addr := range config.Addrs {
+		containerActions = append(containerActions, neslink.LAAddAddr(neslink.LPName(config.IfName), addr))
+	}
+	containerActions = append(containerActions, neslink.LASetUp(neslink.LPName(config.IfName)))
+	if config.Gateway != "" {
+		containerActions = append(containerActions, neslink.LAAddRoute(neslink.LPName(config.IfName), "", config.Gateway))
+	}
+	if err := neslink.Do(containerNs, containerActions...); err != nil {
+		cancel()
+		return nil, errors.Join(fmt.Errorf("failed to configure interface in container"), err, a.deleteHostLink())
+	}
+
+	// 4. clean up once the container stops
+	go func() {
+		select {
+		case <-msgs:
+			a.detach(nil)
+		case err := <-errs:
+			if !errors.Is(err, context.Canceled) {
+				a.detach(fmt.Errorf("stopped watching container events: %w", err))
+			}
+		}
+	}()
+	return a, nil
+}
+
+// Detach removes the attached interface from the container and stops watching
+// for the container to stop. Any error from cleaning up is returned.
+func (a *Attachment) Detach() error {
+	a.detach(nil)
+	return a.Err()
+}
+
+// Done returns a channel that is closed once the attachment has been detached,
+// either manually or as a result of the container stopping.
+func (a *Attachment) Done() <-chan struct{} {
+	return a.done
+}
+
+// Err returns any error that occurred when the attachment was detached. This
+// should only be checked after Done is closed.
+func (a *Attachment) Err() error {
+	select {
+	case <-a.done:
+		return a.err
+	default:
+		return nil
+	}
+}
+
+// detach cleans up the attachment exactly once, recording the given error
+// along with any from cleaning up.
+func (a *Attachment) detach(cause error) {
+	a.once.Do(func() {
+		a.cancel()
+		a.err = errors.Join(cause, a.deleteHostLink())
+		close(a.done)
+	})
+}
+
+// deleteHostLink deletes the host end of the veth pair (and so the container
+// end) if it still exists.
+func (a *Attachment) deleteHostLink() error {
+	err := neslink.Do(neslink.NPNow(), neslink.LADelete(neslink.LPName(a.HostIfName)))
+	if err != nil && errors.Is(err, neslink.ErrLinkNotFound) {
+		return nil
+	}
+	return err
+}
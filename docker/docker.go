@@ -1,29 +1,63 @@
+// Package docker provides netns providers for docker containers, sandboxes and
+// networks, along with helpers to watch and attach to containers. The providers
+// use the given docker api client, which can not be serialised, so they have no
+// descriptor and can not be sent via the agent. Where that is needed, the netns
+// can instead be provided by path (see DefaultNetnsPath) or process.
 package docker
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path"
 	"strings"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
 	"github.com/willfantom/neslink"
 )
 
+const (
+	// DefaultNetnsPath is the directory in which docker mounts the network
+	// namespaces it creates for sandboxes.
+	DefaultNetnsPath string = "/var/run/docker/netns"
+
+	composeProjectLabel string = "com.docker.compose.project"
+	composeServiceLabel string = "com.docker.compose.service"
+)
+
+var (
+	errNoContainer         error = errors.New("no container matches the given conditions")
+	errAmbiguousContainer  error = errors.New("more than one container matches the given conditions")
+	errNoNetworkSandbox    error = errors.New("docker network does not have a sandbox netns")
+	errContainerNotRunning error = errors.New("docker container is not running")
+)
+
 // NPName returns a netns provider that provides the netns path for the docker
 // container with the given name.
 func NPName(cli *client.Client, containerName string) neslink.NsProvider {
+	return NPNameContext(context.Background(), cli, containerName)
+}
+
+// NPNameContext returns a netns provider that provides the netns path for the
+// docker container with the given name. The given context is used for all
+// requests made to the docker api.
+func NPNameContext(ctx context.Context, cli *client.Client, containerName string) neslink.NsProvider {
 	return neslink.NPGeneric(
 		"docker-container-name",
 		func() (neslink.Namespace, error) {
-			containers, err := cli.ContainerList(context.Background(), types.ContainerListOptions{})
+			// the name filter is not an exact match, so the names are still checked
+			containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
+				Filters: filters.NewArgs(filters.Arg("name", containerName)),
+			})
 			if err != nil {
 				return neslink.Namespace(""), fmt.Errorf("failed to get container list:  %w", err)
 			}
 			for _, c := range containers {
 				for _, n := range c.Names {
 					if strings.EqualFold(strings.TrimPrefix(n, "/"), containerName) {
-						return NPID(cli, c.ID).Provide()
+						return NPIDContext(ctx, cli, c.ID).Provide()
 					}
 				}
 			}
@@ -35,14 +69,136 @@ func NPName(cli *client.Client, containerName string) neslink.NsProvider {
 // NPID returns a netns provider that provides the netns path for the docker
 // container with the given container id.
 func NPID(cli *client.Client, containerID string) neslink.NsProvider {
+	return NPIDContext(context.Background(), cli, containerID)
+}
+
+// NPIDContext returns a netns provider that provides the netns path for the
+// docker container with the given container id. The given context is used for
+// all requests made to the docker api.
+func NPIDContext(ctx context.Context, cli *client.Client, containerID string) neslink.NsProvider {
 	return neslink.NPGeneric(
 		"docker-container-id",
 		func() (neslink.Namespace, error) {
-			c, err := cli.ContainerInspect(context.Background(), containerID)
+			c, err := cli.ContainerInspect(ctx, containerID)
 			if err != nil {
 				return neslink.Namespace(""), fmt.Errorf("failed to get container infomation:  %w", err)
 			}
+			if c.State == nil || c.State.Pid == 0 {
+				return neslink.Namespace(""), fmt.Errorf("%w: %s", errContainerNotRunning, containerID)
+			}
 			return neslink.NPProcess(c.State.Pid).Provide()
 		},
 	)
 }
+
+// NPLabels returns a netns provider that provides the netns path for the
+// running docker container that has all the given labels. An empty label value
+// matches any container that has the label key. If more than one container
+// matches, an error is returned.
+func NPLabels(ctx context.Context, cli *client.Client, labels map[string]string) neslink.NsProvider {
+	return neslink.NPGeneric(
+		"docker-container-labels",
+		func() (neslink.Namespace, error) {
+			id, err := containerByLabels(ctx, cli, labels)
+			if err != nil {
+				return neslink.Namespace(""), err
+			}
+			return NPIDContext(ctx, cli, id).Provide()
+		},
+	)
+}
+
+// NPComposeService returns a netns provider that provides the netns path for
+// the running container of the given docker compose project and service. If
+// the service has more than one running container (replicas), an error is
+// returned.
+func NPComposeService(ctx context.Context, cli *client.Client, project, service string) neslink.NsProvider {
+	return neslink.NPGeneric(
+		"docker-compose-service",
+		func() (neslink.Namespace, error) {
+			id, err := containerByLabels(ctx, cli, map[string]string{
+				composeProjectLabel: project,
+				composeServiceLabel: service,
+			})
+			if err != nil {
+				return neslink.Namespace(""), err
+			}
+			return NPIDContext(ctx, cli, id).Provide()
+		},
+	)
+}
+
+// NPSandbox returns a netns provider that provides the path of the netns that
+// docker has mounted for the sandbox of the container with the given name or
+// id. Unlike NPIDContext, this does not depend on the container's process.
+func NPSandbox(ctx context.Context, cli *client.Client, container string) neslink.NsProvider {
+	return neslink.NPGeneric(
+		"docker-container-sandbox",
+		func() (neslink.Namespace, error) {
+			c, err := cli.ContainerInspect(ctx, container)
+			if err != nil {
+				return neslink.Namespace(""), fmt.Errorf("failed to get container infomation:  %w", err)
+			}
+			if c.NetworkSettings == nil || c.NetworkSettings.SandboxKey == "" {
+				return neslink.Namespace(""), fmt.Errorf("container %s does not have a sandbox netns", container)
+			}
+			return neslink.Namespace(c.NetworkSettings.SandboxKey), nil
+		},
+	)
+}
+
+// NPNetwork returns a netns provider that provides the path of the netns
+// docker creates for the sandbox of the network with the given name or id.
+// Only networks that are backed by a netns of their own (such as overlay
+// networks) have a sandbox, otherwise an error is returned. The netns is
+// expected to be mounted in the DefaultNetnsPath.
+func NPNetwork(ctx context.Context, cli *client.Client, network string) neslink.NsProvider {
+	return neslink.NPGeneric(
+		"docker-network",
+		func() (neslink.Namespace, error) {
+			n, err := cli.NetworkInspect(ctx, network, types.NetworkInspectOptions{})
+			if err != nil {
+				return neslink.Namespace(""), fmt.Errorf("failed to get network infomation:  %w", err)
+			}
+			if n.Driver != "overlay" || len(n.ID) < 10 {
+				return neslink.Namespace(""), fmt.Errorf("%w: %s (driver %s)", errNoNetworkSandbox, network, n.Driver)
+			}
+			// docker names network sandboxes "1-" followed by a short network id
+			return neslink.Namespace(path.Join(DefaultNetnsPath, "1-"+n.ID[:10])), nil
+		},
+	)
+}
+
+// containerByLabels returns the id of the only running container that has all
+// the given labels.
+func containerByLabels(ctx context.Context, cli *client.Client, labels map[string]string) (string, error) {
+	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{Filters: labelArgs(filters.NewArgs(), labels)})
+	if err != nil {
+		return "", fmt.Errorf("failed to get container list:  %w", err)
+	}
+	switch len(containers) {
+	case 0:
+		return "", fmt.Errorf("%w: labels %v", errNoContainer, labels)
+	case 1:
+		return containers[0].ID, nil
+	default:
+		names := make([]string, len(containers))
+		for idx, c := range containers {
+			names[idx] = strings.TrimPrefix(strings.Join(c.Names, ","), "/")
+		}
+		return "", fmt.Errorf("%w: labels %v matched %v", errAmbiguousContainer, labels, names)
+	}
+}
+
+// labelArgs adds a label filter to the given args for each of the given labels.
+// An empty label value matches any value.
+func labelArgs(args filters.Args, labels map[string]string) filters.Args {
+	for k, v := range labels {
+		if v == "" {
+			args.Add("label", k)
+		} else {
+			args.Add("label", k+"="+v)
+		}
+	}
+	return args
+}
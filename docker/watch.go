@@ -0,0 +1,144 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/willfantom/neslink"
+)
+
+const (
+	// WatchEventStart is the event of a WatchResult for setup actions that
+	// were performed when a container started (or was already running).
+	WatchEventStart string = "start"
+
+	// WatchEventDie is the event of a WatchResult for teardown actions that
+	// were performed when a container stopped.
+	WatchEventDie string = "die"
+)
+
+// WatchConfig describes the containers a Watch call should react to, and the
+// actions that should be performed. Containers are matched if they have all
+// the given labels (an empty label value matches any value). Setup actions are
+// performed in the netns of a matching container when it starts. Since the
+// netns of a container is destroyed with it, teardown actions can not be
+// performed in the container's netns. Instead, when a matching container
+// stops, Teardown (if set) is called with the ID of the container, and the
+// actions it returns are performed in the netns of the caller of Watch, for
+// example to clean up host side links created for that container. Teardown is
+// only called for containers that the setup actions were performed for by the
+// same Watch call. If Existing is true, the setup actions are also performed
+// for matching containers that are already running; otherwise, those
+// containers are ignored when they stop.
+type WatchConfig struct {
+	Labels   map[string]string
+	Setup    []neslink.Action
+	Teardown func(containerID string) []neslink.Action
+	Existing bool
+}
+
+// WatchResult is the outcome of performing the setup or teardown actions for a
+// single container event. Err is nil if the actions were all successful. If
+// the watch itself fails, a final result with an empty ContainerID is sent.
+type WatchResult struct {
+	ContainerID string
+	Event       string
+	Err         error
+}
+
+// Watch subscribes to docker events and performs the configured actions as
+// matching containers start and stop, reporting the outcome of each on the
+// returned channel. The channel is closed once the given context is done or
+// the event stream fails. Results should be consumed, as event handling is
+// paused whilst the channel is full. The setup actions are performed once per
+// start of a container, even if it is both listed as running (with Existing)
+// and seen in a start event.
+func Watch(ctx context.Context, cli *client.Client, config WatchConfig) <-chan WatchResult {
+	results := make(chan WatchResult, 16)
+	go func() {
+		defer close(results)
+		send := func(result WatchResult) bool {
+			select {
+			case results <- result:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		// 1. subscribe before listing existing containers so none are missed,
+		// tracking those set up so a start seen in both is only handled once
+		running := make(map[string]bool)
+		msgs, errs := cli.Events(ctx, types.EventsOptions{
+			Filters: labelArgs(filters.NewArgs(
+				filters.Arg("type", "container"),
+				filters.Arg("event", WatchEventStart),
+				filters.Arg("event", WatchEventDie),
+			), config.Labels),
+		})
+
+		// 2. setup containers that are already running
+		if config.Existing {
+			containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
+				Filters: labelArgs(filters.NewArgs(), config.Labels),
+			})
+			if err != nil {
+				send(WatchResult{Err: fmt.Errorf("failed to get container list:  %w", err)})
+				return
+			}
+			for _, c := range containers {
+				running[c.ID] = true
+				if !send(WatchResult{
+					ContainerID: c.ID,
+					Event:       WatchEventStart,
+					Err:         neslink.Do(NPIDContext(ctx, cli, c.ID), config.Setup...),
+				}) {
+					return
+				}
+			}
+		}
+
+		// 3. react to containers starting and stopping
+		for {
+			select {
+			case msg := <-msgs:
+				result := WatchResult{
+					ContainerID: msg.Actor.ID,
+					Event:       msg.Action,
+				}
+				switch msg.Action {
+				case WatchEventStart:
+					if running[msg.Actor.ID] {
+						continue
+					}
+					running[msg.Actor.ID] = true
+					result.Err = neslink.Do(NPIDContext(ctx, cli, msg.Actor.ID), config.Setup...)
+				case WatchEventDie:
+					if !running[msg.Actor.ID] {
+						continue
+					}
+					delete(running, msg.Actor.ID)
+					if config.Teardown == nil {
+						continue
+					}
+					result.Err = neslink.Do(neslink.NPNow(), config.Teardown(msg.Actor.ID)...)
+				default:
+					continue
+				}
+				if !send(result) {
+					return
+				}
+			case err := <-errs:
+				if !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+					send(WatchResult{Err: fmt.Errorf("stopped watching container events: %w", err)})
+				}
+				return
+			}
+		}
+	}()
+	return results
+}
@@ -0,0 +1,26 @@
+package neslink
+
+import "sort"
+
+// RegisteredKinds returns every kind registered to build actions and
+// providers, so that tests can check they cover each of them.
+func RegisteredKinds() []string {
+	kinds := []string{}
+	kinds = append(kinds, actionKinds.kinds()...)
+	kinds = append(kinds, nsProviderKinds.kinds()...)
+	kinds = append(kinds, linkProviderKinds.kinds()...)
+	kinds = append(kinds, linksProviderKinds.kinds()...)
+	sort.Strings(kinds)
+	return kinds
+}
+
+// kinds returns the kinds in the registry.
+func (r *registry[T]) kinds() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	kinds := make([]string, 0, len(r.builders))
+	for kind := range r.builders {
+		kinds = append(kinds, kind)
+	}
+	return kinds
+}
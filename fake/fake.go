@@ -0,0 +1,413 @@
+// Package fake provides an in-memory neslink backend that models network
+// namespaces, links, addresses and routes, so that code built on neslink can
+// be tested in ordinary go tests without privileges. For example:
+//
+//	b := fake.New()
+//	prev := neslink.SetBackend(b)
+//	defer neslink.SetBackend(prev)
+//
+//	err := neslink.Do(neslink.NPNow(),
+//		neslink.NANewNsAt("/run/netns", "example"),
+//		neslink.LANewBridge("br0"),
+//	)
+//	links, _ := b.Links("/run/netns/example")
+//
+// The fake only models what the neslink actions need, and so differs from the
+// kernel in places. Notably, Do calls are performed one at a time (and should
+// be made from a single goroutine), addresses are never tentative, no prefix
+// or local routes are created for addresses, and subscriptions never deliver
+// updates, as nothing can change whilst an action waits. ListNamespaces (and
+// so NPNetNsID and NPSameAs) scans /proc rather than using neslink.Backend, and
+// so still finds the namespaces of the kernel.
+package fake
+
+import (
+	"fmt"
+	"io/fs"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/vishvananda/netlink"
+	"github.com/willfantom/neslink"
+	"golang.org/x/sys/unix"
+)
+
+var _ neslink.Backend = (*Backend)(nil)
+
+// Backend is an in-memory neslink.Backend. It should be created via New.
+type Backend struct {
+	thread sync.Mutex
+	mu     sync.Mutex
+
+	root    *namespace
+	current *namespace
+	paths   map[neslink.Namespace]*namespace
+	fds     map[neslink.NsFd]*namespace
+	nss     []*namespace
+
+	nextNs    int
+	nextFd    int
+	nextIndex int
+}
+
+// namespace is a single fake network namespace.
+type namespace struct {
+	id     int
+	links  map[int]netlink.Link
+	addrs  []netlink.Addr
+	routes []netlink.Route
+	fous   []netlink.Fou
+	nsids  map[*namespace]int
+}
+
+// path returns the path the namespace can always be found at, similar to the
+// /proc paths of the kernel.
+func (ns *namespace) path() neslink.Namespace {
+	return neslink.Namespace(fmt.Sprintf("fake:net:[%d]", ns.id))
+}
+
+// New creates a fake backend containing a single (root) netns, which the
+// caller is considered to be in. The root netns has a loopback link.
+func New() *Backend {
+	b := &Backend{
+		paths:     make(map[neslink.Namespace]*namespace),
+		fds:       make(map[neslink.NsFd]*namespace),
+		nextNs:    1,
+		nextFd:    1000,
+		nextIndex: 2,
+	}
+	b.root = b.newNamespace()
+	b.current = b.root
+	return b
+}
+
+// Root returns the path of the root netns.
+func (b *Backend) Root() neslink.Namespace {
+	return b.root.path()
+}
+
+// Namespaces returns the paths that netns have been bound to via NewNsAt, in
+// sorted order.
+func (b *Backend) Namespaces() []neslink.Namespace {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	paths := make([]neslink.Namespace, 0, len(b.paths))
+	for p, ns := range b.paths {
+		if p != ns.path() {
+			paths = append(paths, p)
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool { return paths[i] < paths[j] })
+	return paths
+}
+
+// Links returns the links in the netns at the given path, ordered by index.
+func (b *Backend) Links(path neslink.Namespace) ([]netlink.Link, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ns, err := b.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	return ns.linkList(), nil
+}
+
+// Addrs returns the addresses in the netns at the given path.
+func (b *Backend) Addrs(path neslink.Namespace) ([]netlink.Addr, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ns, err := b.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	return append([]netlink.Addr{}, ns.addrs...), nil
+}
+
+// Routes returns the routes in the netns at the given path.
+func (b *Backend) Routes(path neslink.Namespace) ([]netlink.Route, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ns, err := b.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	return append([]netlink.Route{}, ns.routes...), nil
+}
+
+// Fous returns the FOU receive ports in the netns at the given path.
+func (b *Backend) Fous(path neslink.Namespace) ([]netlink.Fou, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ns, err := b.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	return append([]netlink.Fou{}, ns.fous...), nil
+}
+
+// LockThread holds the fake's single thread for the duration of a Do call.
+func (b *Backend) LockThread() {
+	b.thread.Lock()
+}
+
+// UnlockThread releases the fake's single thread, returning it to the root
+// netns and removing any netns that are no longer referenced.
+func (b *Backend) UnlockThread() {
+	b.mu.Lock()
+	b.current = b.root
+	b.gc()
+	b.mu.Unlock()
+	b.thread.Unlock()
+}
+
+// CurrentNs returns the path of the netns the fake's thread is in.
+func (b *Backend) CurrentNs() (neslink.Namespace, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.current.path(), nil
+}
+
+// OpenNs opens the netns at the given path.
+func (b *Backend) OpenNs(path neslink.Namespace) (neslink.NsFd, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ns, err := b.lookup(path)
+	if err != nil {
+		return neslink.NsFdNone, fmt.Errorf("failed to open namespace: %w", err)
+	}
+	fd := neslink.NsFd(b.nextFd)
+	b.nextFd++
+	b.fds[fd] = ns
+	return fd, nil
+}
+
+// CloseNs closes a netns fd opened via OpenNs.
+func (b *Backend) CloseNs(fd neslink.NsFd) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.fds[fd]; !ok {
+		return fmt.Errorf("failed to close netns file descriptor %d: %w", fd, unix.EBADF)
+	}
+	delete(b.fds, fd)
+	b.gc()
+	return nil
+}
+
+// SetNs moves the fake's thread to the netns of the given fd.
+func (b *Backend) SetNs(fd neslink.NsFd) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ns, ok := b.fds[fd]
+	if !ok {
+		return unix.EBADF
+	}
+	b.current = ns
+	return nil
+}
+
+// ValidateNs checks that the given path is that of a fake netns.
+func (b *Backend) ValidateNs(path neslink.Namespace) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, err := b.lookup(path)
+	return err
+}
+
+// IdentifyNs returns the identity of the fake netns at the given path, where
+// the inode is the number in its fake:net:[N] path.
+func (b *Backend) IdentifyNs(path neslink.Namespace) (neslink.NsID, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ns, err := b.lookup(path)
+	if err != nil {
+		return neslink.NsID{}, err
+	}
+	return neslink.NsID{Inode: uint64(ns.id)}, nil
+}
+
+// NewNsAt creates a new netns bound to the given path, and moves the fake's
+// thread to it.
+func (b *Backend) NewNsAt(mountpath string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.paths[neslink.Namespace(mountpath)]; ok {
+		return fmt.Errorf("namespace mount file already exists")
+	}
+	ns := b.newNamespace()
+	b.paths[neslink.Namespace(mountpath)] = ns
+	b.current = ns
+	return nil
+}
+
+// DeleteNsAt unbinds the netns bound to the given path. As with the kernel,
+// the netns itself is only removed once nothing else refers to it.
+func (b *Backend) DeleteNsAt(mountpath string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ns, ok := b.paths[neslink.Namespace(mountpath)]
+	if !ok || neslink.Namespace(mountpath) == ns.path() {
+		return fmt.Errorf("failed to unmount netns: %w", unix.EINVAL)
+	}
+	delete(b.paths, neslink.Namespace(mountpath))
+	b.gc()
+	return nil
+}
+
+// NetNsID returns the netnsid that the netns of origin has assigned to the
+// netns of target, or -1 if none has been assigned.
+func (b *Backend) NetNsID(origin, target neslink.NsFd) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	originNs, targetNs := b.fds[origin], b.fds[target]
+	if originNs == nil || targetNs == nil {
+		return -1, fmt.Errorf("failed to get netnsid: %w", unix.EBADF)
+	}
+	if nsid, ok := originNs.nsids[targetNs]; ok {
+		return nsid, nil
+	}
+	return -1, nil
+}
+
+// SetNetNsID assigns the given netnsid to the netns of target, as seen from
+// the netns of origin. As with the kernel, a negative netnsid assigns the
+// lowest free id, and an error is returned if the target already has an id or
+// the id is in use.
+func (b *Backend) SetNetNsID(origin, target neslink.NsFd, nsid int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	originNs, targetNs := b.fds[origin], b.fds[target]
+	if originNs == nil || targetNs == nil {
+		return fmt.Errorf("failed to set netnsid: %w", unix.EBADF)
+	}
+	if _, ok := originNs.nsids[targetNs]; ok {
+		return fmt.Errorf("failed to set netnsid: %w", unix.EEXIST)
+	}
+	if nsid < 0 {
+		originNs.assignID(targetNs)
+		return nil
+	}
+	for _, id := range originNs.nsids {
+		if id == nsid {
+			return fmt.Errorf("failed to set netnsid: %w", unix.EEXIST)
+		}
+	}
+	originNs.nsids[targetNs] = nsid
+	return nil
+}
+
+// assignID returns the netnsid the netns has assigned to the target netns,
+// assigning the lowest free id if there is none, as the kernel does when a
+// link refers to another netns.
+func (ns *namespace) assignID(target *namespace) int {
+	if nsid, ok := ns.nsids[target]; ok {
+		return nsid
+	}
+	used := make(map[int]bool, len(ns.nsids))
+	for _, id := range ns.nsids {
+		used[id] = true
+	}
+	nsid := 0
+	for used[nsid] {
+		nsid++
+	}
+	ns.nsids[target] = nsid
+	return nsid
+}
+
+// LinkSubscribe never delivers any updates, closing the channel once done is
+// closed.
+func (b *Backend) LinkSubscribe(updates chan netlink.LinkUpdate, done chan struct{}, errs func(error)) error {
+	go func() {
+		<-done
+		close(updates)
+	}()
+	return nil
+}
+
+// AddrSubscribe never delivers any updates, closing the channel once done is
+// closed.
+func (b *Backend) AddrSubscribe(updates chan netlink.AddrUpdate, done chan struct{}, errs func(error)) error {
+	go func() {
+		<-done
+		close(updates)
+	}()
+	return nil
+}
+
+// RouteSubscribe never delivers any updates, closing the channel once done is
+// closed.
+func (b *Backend) RouteSubscribe(updates chan netlink.RouteUpdate, done chan struct{}, errs func(error)) error {
+	go func() {
+		<-done
+		close(updates)
+	}()
+	return nil
+}
+
+// newNamespace creates a new netns with a loopback link, which is down as in
+// a new kernel netns.
+func (b *Backend) newNamespace() *namespace {
+	ns := &namespace{
+		id:    b.nextNs,
+		links: make(map[int]netlink.Link),
+		nsids: make(map[*namespace]int),
+	}
+	b.nextNs++
+	lo := &netlink.Device{LinkAttrs: netlink.NewLinkAttrs()}
+	lo.Name = "lo"
+	lo.Index = 1
+	lo.MTU = 65536
+	lo.EncapType = "loopback"
+	lo.Flags = net.FlagLoopback
+	lo.RawFlags = unix.IFF_LOOPBACK
+	lo.OperState = netlink.OperDown
+	lo.NetNsID = -1
+	ns.links[lo.Index] = lo
+	b.nss = append(b.nss, ns)
+	b.paths[ns.path()] = ns
+	return ns
+}
+
+// lookup finds the netns at the given path.
+func (b *Backend) lookup(path neslink.Namespace) (*namespace, error) {
+	ns, ok := b.paths[path]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", path, fs.ErrNotExist)
+	}
+	return ns, nil
+}
+
+// gc removes any netns that is not the root or current netns, is not bound to
+// a path, and has no open fds. As with the kernel, the links in a removed
+// netns are deleted, along with the peers of any veths.
+func (b *Backend) gc() {
+	referenced := map[*namespace]bool{b.root: true, b.current: true}
+	for p, ns := range b.paths {
+		if p != ns.path() {
+			referenced[ns] = true
+		}
+	}
+	for _, ns := range b.fds {
+		referenced[ns] = true
+	}
+	kept := b.nss[:0]
+	for _, ns := range b.nss {
+		if referenced[ns] {
+			kept = append(kept, ns)
+			continue
+		}
+		for _, l := range ns.linkList() {
+			b.deleteLink(ns, l)
+		}
+		delete(b.paths, ns.path())
+	}
+	b.nss = kept
+	for _, ns := range b.nss {
+		for target := range ns.nsids {
+			if !referenced[target] {
+				delete(ns.nsids, target)
+			}
+		}
+	}
+}
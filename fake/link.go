@@ -0,0 +1,792 @@
+package fake
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"reflect"
+	"sort"
+
+	"github.com/vishvananda/netlink"
+	"github.com/willfantom/neslink"
+	"golang.org/x/sys/unix"
+)
+
+// errLinkNotFound is returned when a link does not exist in the current netns.
+// As with the kernel backend, this matches neslink.ErrLinkNotFound via
+// errors.Is, as well as ENODEV.
+type errLinkNotFound struct {
+	link string
+}
+
+func (e errLinkNotFound) Error() string {
+	return fmt.Sprintf("Link %s not found", e.link)
+}
+
+func (errLinkNotFound) Is(target error) bool {
+	return target == neslink.ErrLinkNotFound || target == unix.ENODEV
+}
+
+// clone returns a shallow copy of the given link, so that the links held by
+// the fake can not be modified by callers. Slices within the link attributes
+// are always replaced rather than modified by the fake.
+func clone(l netlink.Link) netlink.Link {
+	v := reflect.ValueOf(l)
+	if v.Kind() != reflect.Pointer {
+		return l
+	}
+	c := reflect.New(v.Elem().Type())
+	c.Elem().Set(v.Elem())
+	return c.Interface().(netlink.Link)
+}
+
+// linkList returns copies of the links in the netns, ordered by index.
+func (ns *namespace) linkList() []netlink.Link {
+	links := make([]netlink.Link, 0, len(ns.links))
+	for _, l := range ns.links {
+		links = append(links, clone(l))
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].Attrs().Index < links[j].Attrs().Index })
+	return links
+}
+
+// byName finds the link in the netns with the given name or alternative name.
+func (ns *namespace) byName(name string) netlink.Link {
+	for _, l := range ns.links {
+		if l.Attrs().Name == name {
+			return l
+		}
+		for _, alt := range l.Attrs().AltNames {
+			if alt == name {
+				return l
+			}
+		}
+	}
+	return nil
+}
+
+// find finds the link in the current netns that the given link refers to,
+// using its index if it has one, otherwise its name.
+func (b *Backend) find(link netlink.Link) (netlink.Link, error) {
+	if link == nil || link.Attrs() == nil {
+		return nil, errLinkNotFound{}
+	}
+	if link.Attrs().Index != 0 {
+		if l, ok := b.current.links[link.Attrs().Index]; ok {
+			return l, nil
+		}
+		return nil, errLinkNotFound{fmt.Sprintf("with index %d", link.Attrs().Index)}
+	}
+	if l := b.current.byName(link.Attrs().Name); l != nil {
+		return l, nil
+	}
+	return nil, errLinkNotFound{link.Attrs().Name}
+}
+
+// modify applies the given change to the link in the current netns that the
+// given link refers to.
+func (b *Backend) modify(link netlink.Link, change func(l netlink.Link) error) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	l, err := b.find(link)
+	if err != nil {
+		return err
+	}
+	return change(l)
+}
+
+// LinkAdd adds the given link to the current netns. Veth peers are added to
+// the netns given as the PeerNamespace (which must be a netlink.NsFd) or the
+// current netns.
+func (b *Backend) LinkAdd(link netlink.Link) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	attrs := link.Attrs()
+	if attrs == nil || attrs.Name == "" {
+		return unix.EINVAL
+	}
+	if b.current.byName(attrs.Name) != nil {
+		return unix.EEXIST
+	}
+	l := b.newLink(link)
+
+	if veth, ok := link.(*netlink.Veth); ok {
+		peerNs := b.current
+		if nsfd, ok := veth.PeerNamespace.(netlink.NsFd); ok {
+			if peerNs, ok = b.fds[neslink.NsFd(nsfd)]; !ok {
+				return unix.EBADF
+			}
+		}
+		if veth.PeerName == "" || (peerNs.byName(veth.PeerName) != nil) || (peerNs == b.current && veth.PeerName == attrs.Name) {
+			if veth.PeerName == "" {
+				return unix.EINVAL
+			}
+			return unix.EEXIST
+		}
+		peer := &netlink.Veth{
+			LinkAttrs: netlink.NewLinkAttrs(),
+			PeerName:  attrs.Name,
+		}
+		peer.Name = veth.PeerName
+		peer.HardwareAddr = veth.PeerHardwareAddr
+		peer.MTU = attrs.MTU
+		p := b.newLink(peer)
+		p.Attrs().ParentIndex = l.Attrs().Index
+		l.Attrs().ParentIndex = p.Attrs().Index
+		if peerNs != b.current {
+			p.Attrs().NetNsID = peerNs.assignID(b.current)
+			l.Attrs().NetNsID = b.current.assignID(peerNs)
+		}
+		peerNs.links[p.Attrs().Index] = p
+	}
+
+	b.current.links[l.Attrs().Index] = l
+	attrs.Index = l.Attrs().Index
+	return nil
+}
+
+// newLink creates the fake's copy of the given link, filling in the
+// attributes the kernel would.
+func (b *Backend) newLink(link netlink.Link) netlink.Link {
+	l := clone(link)
+	attrs := l.Attrs()
+	attrs.Index = b.nextIndex
+	b.nextIndex++
+	if attrs.MTU == 0 {
+		attrs.MTU = 1500
+	}
+	if attrs.TxQLen <= 0 {
+		attrs.TxQLen = 1000
+	}
+	if attrs.HardwareAddr == nil && l.Type() != "ipip" && l.Type() != "sit" && l.Type() != "gre" && l.Type() != "ip6tnl" && l.Type() != "wireguard" && l.Type() != "tuntap" {
+		attrs.HardwareAddr = net.HardwareAddr{0x02, 0, 0, 0, byte(attrs.Index >> 8), byte(attrs.Index)}
+	}
+	attrs.Flags = net.FlagBroadcast | net.FlagMulticast
+	attrs.RawFlags = unix.IFF_BROADCAST | unix.IFF_MULTICAST
+	attrs.OperState = netlink.OperDown
+	attrs.NetNsID = -1
+	attrs.MasterIndex = 0
+	attrs.Namespace = nil
+	if veth, ok := l.(*netlink.Veth); ok {
+		veth.PeerNamespace = nil
+	}
+	return l
+}
+
+// LinkDel deletes the link from the current netns, along with the peer of a
+// veth.
+func (b *Backend) LinkDel(link netlink.Link) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	l, err := b.find(link)
+	if err != nil {
+		return err
+	}
+	b.deleteLink(b.current, l)
+	return nil
+}
+
+// deleteLink deletes the link from the given netns, including its addresses
+// and routes. The peer of a veth is deleted too, wherever it is.
+func (b *Backend) deleteLink(ns *namespace, l netlink.Link) {
+	idx := l.Attrs().Index
+	if _, ok := ns.links[idx]; !ok {
+		return
+	}
+	delete(ns.links, idx)
+	b.deleteLinkState(ns, l)
+	if _, ok := l.(*netlink.Veth); ok {
+		for _, peerNs := range b.nss {
+			if peer, ok := peerNs.links[l.Attrs().ParentIndex]; ok {
+				if v, ok := peer.(*netlink.Veth); ok && v.ParentIndex == idx {
+					b.deleteLink(peerNs, peer)
+				}
+			}
+		}
+	}
+}
+
+// LinkByName finds the link in the current netns with the given name or
+// alternative name.
+func (b *Backend) LinkByName(name string) (netlink.Link, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if l := b.current.byName(name); l != nil {
+		return clone(l), nil
+	}
+	return nil, errLinkNotFound{name}
+}
+
+// LinkByIndex finds the link in the current netns with the given index.
+func (b *Backend) LinkByIndex(index int) (netlink.Link, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if l, ok := b.current.links[index]; ok {
+		return clone(l), nil
+	}
+	return nil, errLinkNotFound{fmt.Sprintf("with index %d", index)}
+}
+
+// LinkByAlias finds the link in the current netns with the given alias.
+func (b *Backend) LinkByAlias(alias string) (netlink.Link, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, l := range b.current.linkList() {
+		if l.Attrs().Alias == alias {
+			return l, nil
+		}
+	}
+	return nil, errLinkNotFound{"alias " + alias}
+}
+
+// LinkList lists the links in the current netns.
+func (b *Backend) LinkList() ([]netlink.Link, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.current.linkList(), nil
+}
+
+// LinkSetUp sets the link up. A veth is only operationally up (with a carrier)
+// once both ends are up, whilst other links are as soon as they are up.
+func (b *Backend) LinkSetUp(link netlink.Link) error {
+	return b.modify(link, func(l netlink.Link) error {
+		l.Attrs().Flags |= net.FlagUp
+		l.Attrs().RawFlags |= unix.IFF_UP
+		b.updateOperState(l)
+		return nil
+	})
+}
+
+// LinkSetDown sets the link down.
+func (b *Backend) LinkSetDown(link netlink.Link) error {
+	return b.modify(link, func(l netlink.Link) error {
+		l.Attrs().Flags &^= net.FlagUp
+		l.Attrs().RawFlags &^= unix.IFF_UP
+		b.updateOperState(l)
+		return nil
+	})
+}
+
+// updateOperState sets the operational state and carrier of the link (and the
+// peer of a veth) from whether it is up.
+func (b *Backend) updateOperState(l netlink.Link) {
+	set := func(l netlink.Link, up bool) {
+		if up {
+			l.Attrs().OperState = netlink.OperUp
+			l.Attrs().RawFlags |= unix.IFF_LOWER_UP | unix.IFF_RUNNING
+			l.Attrs().Flags |= net.FlagRunning
+		} else {
+			l.Attrs().OperState = netlink.OperDown
+			l.Attrs().RawFlags &^= unix.IFF_LOWER_UP | unix.IFF_RUNNING
+			l.Attrs().Flags &^= net.FlagRunning
+		}
+	}
+	up := l.Attrs().Flags&net.FlagUp != 0
+	if _, ok := l.(*netlink.Veth); !ok {
+		set(l, up)
+		return
+	}
+	peer := b.vethPeer(l)
+	peerUp := peer != nil && peer.Attrs().Flags&net.FlagUp != 0
+	set(l, up && peerUp)
+	if peer != nil {
+		set(peer, up && peerUp)
+	}
+}
+
+// vethPeer finds the peer of the given veth, in any netns.
+func (b *Backend) vethPeer(l netlink.Link) netlink.Link {
+	for _, ns := range b.nss {
+		if peer, ok := ns.links[l.Attrs().ParentIndex]; ok && peer.Attrs().ParentIndex == l.Attrs().Index {
+			return peer
+		}
+	}
+	return nil
+}
+
+// LinkSetName renames the link.
+func (b *Backend) LinkSetName(link netlink.Link, name string) error {
+	return b.modify(link, func(l netlink.Link) error {
+		if other := b.current.byName(name); other != nil && other != l {
+			return unix.EEXIST
+		}
+		l.Attrs().Name = name
+		if peer := b.vethPeer(l); peer != nil {
+			peer.(*netlink.Veth).PeerName = name
+		}
+		return nil
+	})
+}
+
+// LinkSetAlias sets the alias of the link.
+func (b *Backend) LinkSetAlias(link netlink.Link, alias string) error {
+	return b.modify(link, func(l netlink.Link) error {
+		l.Attrs().Alias = alias
+		return nil
+	})
+}
+
+// LinkSetHardwareAddr sets the hardware address of the link.
+func (b *Backend) LinkSetHardwareAddr(link netlink.Link, hwaddr net.HardwareAddr) error {
+	return b.modify(link, func(l netlink.Link) error {
+		l.Attrs().HardwareAddr = append(net.HardwareAddr{}, hwaddr...)
+		return nil
+	})
+}
+
+// LinkSetMTU sets the MTU of the link.
+func (b *Backend) LinkSetMTU(link netlink.Link, mtu int) error {
+	return b.modify(link, func(l netlink.Link) error {
+		if mtu <= 0 {
+			return unix.EINVAL
+		}
+		l.Attrs().MTU = mtu
+		return nil
+	})
+}
+
+// LinkSetTxQLen sets the transmit queue length of the link.
+func (b *Backend) LinkSetTxQLen(link netlink.Link, qlen int) error {
+	return b.modify(link, func(l netlink.Link) error {
+		l.Attrs().TxQLen = qlen
+		return nil
+	})
+}
+
+// LinkSetGroup sets the group of the link.
+func (b *Backend) LinkSetGroup(link netlink.Link, group int) error {
+	return b.modify(link, func(l netlink.Link) error {
+		l.Attrs().Group = uint32(group)
+		return nil
+	})
+}
+
+// LinkSetGSOMaxSize sets the GSO maximum size of the link.
+func (b *Backend) LinkSetGSOMaxSize(link netlink.Link, maxSize int) error {
+	return b.modify(link, func(l netlink.Link) error {
+		l.Attrs().GSOMaxSize = uint32(maxSize)
+		return nil
+	})
+}
+
+// LinkSetGSOMaxSegs sets the GSO maximum segments of the link.
+func (b *Backend) LinkSetGSOMaxSegs(link netlink.Link, maxSegs int) error {
+	return b.modify(link, func(l netlink.Link) error {
+		l.Attrs().GSOMaxSegs = uint32(maxSegs)
+		return nil
+	})
+}
+
+// LinkSetGROMaxSize sets the GRO maximum size of the link.
+func (b *Backend) LinkSetGROMaxSize(link netlink.Link, maxSize int) error {
+	return b.modify(link, func(l netlink.Link) error {
+		l.Attrs().GROMaxSize = uint32(maxSize)
+		return nil
+	})
+}
+
+// LinkSetMaster sets the master of the link, which must be in the same netns.
+func (b *Backend) LinkSetMaster(link netlink.Link, master netlink.Link) error {
+	return b.modify(link, func(l netlink.Link) error {
+		m, err := b.find(master)
+		if err != nil {
+			return err
+		}
+		if m == l {
+			return unix.ELOOP
+		}
+		l.Attrs().MasterIndex = m.Attrs().Index
+		return nil
+	})
+}
+
+// LinkSetNoMaster removes the master of the link.
+func (b *Backend) LinkSetNoMaster(link netlink.Link) error {
+	return b.modify(link, func(l netlink.Link) error {
+		l.Attrs().MasterIndex = 0
+		return nil
+	})
+}
+
+// LinkSetNsFd moves the link to the netns of the given fd. As with the kernel,
+// the link is set down and loses its addresses, routes and master.
+func (b *Backend) LinkSetNsFd(link netlink.Link, fd int) error {
+	return b.modify(link, func(l netlink.Link) error {
+		target, ok := b.fds[neslink.NsFd(fd)]
+		if !ok {
+			return unix.EBADF
+		}
+		if target == b.current {
+			return nil
+		}
+		if l.Attrs().Flags&net.FlagLoopback != 0 {
+			return unix.EINVAL
+		}
+		if target.byName(l.Attrs().Name) != nil {
+			return unix.EEXIST
+		}
+		b.deleteLinkState(b.current, l)
+		delete(b.current.links, l.Attrs().Index)
+		target.links[l.Attrs().Index] = l
+		l.Attrs().MasterIndex = 0
+		l.Attrs().Flags &^= net.FlagUp
+		l.Attrs().RawFlags &^= unix.IFF_UP
+		b.updateOperState(l)
+		if peer := b.vethPeer(l); peer != nil {
+			l.Attrs().NetNsID, peer.Attrs().NetNsID = -1, -1
+			for _, ns := range b.nss {
+				if _, ok := ns.links[peer.Attrs().Index]; ok && ns != target {
+					l.Attrs().NetNsID, peer.Attrs().NetNsID = target.assignID(ns), ns.assignID(target)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// deleteLinkState removes the addresses and routes of the link from the given
+// netns, and removes it as the master of any other links.
+func (b *Backend) deleteLinkState(ns *namespace, l netlink.Link) {
+	idx := l.Attrs().Index
+	ns.addrs = filter(ns.addrs, func(a netlink.Addr) bool { return a.LinkIndex != idx })
+	ns.routes = filter(ns.routes, func(r netlink.Route) bool { return r.LinkIndex != idx })
+	for _, other := range ns.links {
+		if other.Attrs().MasterIndex == idx {
+			other.Attrs().MasterIndex = 0
+		}
+	}
+}
+
+// LinkAddAltName adds an alternative name to the link.
+func (b *Backend) LinkAddAltName(link netlink.Link, name string) error {
+	return b.modify(link, func(l netlink.Link) error {
+		if b.current.byName(name) != nil {
+			return unix.EEXIST
+		}
+		l.Attrs().AltNames = append(append([]string{}, l.Attrs().AltNames...), name)
+		return nil
+	})
+}
+
+// LinkDelAltName removes an alternative name from the link.
+func (b *Backend) LinkDelAltName(link netlink.Link, name string) error {
+	return b.modify(link, func(l netlink.Link) error {
+		altNames := filter(append([]string{}, l.Attrs().AltNames...), func(n string) bool { return n != name })
+		if len(altNames) == len(l.Attrs().AltNames) {
+			return unix.ENOENT
+		}
+		l.Attrs().AltNames = altNames
+		return nil
+	})
+}
+
+// SetPromiscOn enables promiscuous mode on the link.
+func (b *Backend) SetPromiscOn(link netlink.Link) error {
+	return b.setFlag(link, unix.IFF_PROMISC, 0, true, func(a *netlink.LinkAttrs, on bool) { a.Promisc = boolInt(on) })
+}
+
+// SetPromiscOff disables promiscuous mode on the link.
+func (b *Backend) SetPromiscOff(link netlink.Link) error {
+	return b.setFlag(link, unix.IFF_PROMISC, 0, false, func(a *netlink.LinkAttrs, on bool) { a.Promisc = boolInt(on) })
+}
+
+// LinkSetMulticastOn enables multicast on the link.
+func (b *Backend) LinkSetMulticastOn(link netlink.Link) error {
+	return b.setFlag(link, unix.IFF_MULTICAST, net.FlagMulticast, true, func(a *netlink.LinkAttrs, on bool) { a.Multi = boolInt(on) })
+}
+
+// LinkSetMulticastOff disables multicast on the link.
+func (b *Backend) LinkSetMulticastOff(link netlink.Link) error {
+	return b.setFlag(link, unix.IFF_MULTICAST, net.FlagMulticast, false, func(a *netlink.LinkAttrs, on bool) { a.Multi = boolInt(on) })
+}
+
+// LinkSetAllmulticastOn enables receiving all multicast on the link.
+func (b *Backend) LinkSetAllmulticastOn(link netlink.Link) error {
+	return b.setFlag(link, unix.IFF_ALLMULTI, 0, true, func(a *netlink.LinkAttrs, on bool) { a.Allmulti = boolInt(on) })
+}
+
+// LinkSetAllmulticastOff disables receiving all multicast on the link.
+func (b *Backend) LinkSetAllmulticastOff(link netlink.Link) error {
+	return b.setFlag(link, unix.IFF_ALLMULTI, 0, false, func(a *netlink.LinkAttrs, on bool) { a.Allmulti = boolInt(on) })
+}
+
+// LinkSetARPOn enables ARP on the link.
+func (b *Backend) LinkSetARPOn(link netlink.Link) error {
+	return b.setFlag(link, unix.IFF_NOARP, 0, false, nil)
+}
+
+// LinkSetARPOff disables ARP on the link.
+func (b *Backend) LinkSetARPOff(link netlink.Link) error {
+	return b.setFlag(link, unix.IFF_NOARP, 0, true, nil)
+}
+
+// setFlag sets or clears the given raw (and net) flag on the link, also
+// updating the related attribute if given.
+func (b *Backend) setFlag(link netlink.Link, raw uint32, flag net.Flags, on bool, attr func(*netlink.LinkAttrs, bool)) error {
+	return b.modify(link, func(l netlink.Link) error {
+		if on {
+			l.Attrs().RawFlags |= raw
+			l.Attrs().Flags |= flag
+		} else {
+			l.Attrs().RawFlags &^= raw
+			l.Attrs().Flags &^= flag
+		}
+		if attr != nil {
+			attr(l.Attrs(), on)
+		}
+		return nil
+	})
+}
+
+// AddrAdd adds the address to the link, erroring if the link already has it.
+func (b *Backend) AddrAdd(link netlink.Link, addr *netlink.Addr) error {
+	return b.modify(link, func(l netlink.Link) error {
+		if idx := b.addrIndex(l, addr); idx >= 0 {
+			return unix.EEXIST
+		}
+		b.current.addrs = append(b.current.addrs, newAddr(l, addr))
+		return nil
+	})
+}
+
+// AddrReplace adds the address to the link, or replaces it if the link
+// already has it.
+func (b *Backend) AddrReplace(link netlink.Link, addr *netlink.Addr) error {
+	return b.modify(link, func(l netlink.Link) error {
+		if idx := b.addrIndex(l, addr); idx >= 0 {
+			b.current.addrs[idx] = newAddr(l, addr)
+			return nil
+		}
+		b.current.addrs = append(b.current.addrs, newAddr(l, addr))
+		return nil
+	})
+}
+
+// AddrDel removes the address from the link.
+func (b *Backend) AddrDel(link netlink.Link, addr *netlink.Addr) error {
+	return b.modify(link, func(l netlink.Link) error {
+		idx := b.addrIndex(l, addr)
+		if idx < 0 {
+			return unix.EADDRNOTAVAIL
+		}
+		b.current.addrs = append(b.current.addrs[:idx], b.current.addrs[idx+1:]...)
+		return nil
+	})
+}
+
+// AddrList lists the addresses of the given family on the link, or on all
+// links if the link is nil.
+func (b *Backend) AddrList(link netlink.Link, family int) ([]netlink.Addr, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	index := 0
+	if link != nil {
+		l, err := b.find(link)
+		if err != nil {
+			return nil, err
+		}
+		index = l.Attrs().Index
+	}
+	addrs := []netlink.Addr{}
+	for _, a := range b.current.addrs {
+		if (index == 0 || a.LinkIndex == index) && familyMatches(family, a.IP) {
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs, nil
+}
+
+// addrIndex finds the position of the address on the link in the current
+// netns, or -1 if the link does not have it.
+func (b *Backend) addrIndex(l netlink.Link, addr *netlink.Addr) int {
+	for idx, a := range b.current.addrs {
+		if a.LinkIndex == l.Attrs().Index && a.IP.Equal(addr.IP) {
+			return idx
+		}
+	}
+	return -1
+}
+
+// newAddr creates the fake's copy of the given address on the link, filling in
+// the attributes the kernel would.
+func newAddr(l netlink.Link, addr *netlink.Addr) netlink.Addr {
+	a := *addr
+	a.LinkIndex = l.Attrs().Index
+	if a.Label == "" && a.IP.To4() != nil {
+		a.Label = l.Attrs().Name
+	}
+	if a.Scope == 0 {
+		if a.IP.IsLoopback() {
+			a.Scope = int(netlink.SCOPE_HOST)
+		} else if a.IP.IsLinkLocalUnicast() {
+			a.Scope = int(netlink.SCOPE_LINK)
+		}
+	}
+	if a.ValidLft == 0 {
+		a.ValidLft, a.PreferedLft = math.MaxUint32, math.MaxUint32
+	}
+	if a.IP.To4() == nil {
+		a.Flags |= unix.IFA_F_PERMANENT
+	}
+	return a
+}
+
+// RouteAdd adds the route in the current netns, to the main table unless
+// another is given.
+func (b *Backend) RouteAdd(route *netlink.Route) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	r := *route
+	if r.Table == 0 {
+		r.Table = unix.RT_TABLE_MAIN
+	}
+	if r.LinkIndex != 0 {
+		if _, ok := b.current.links[r.LinkIndex]; !ok {
+			return unix.ENODEV
+		}
+	}
+	if r.Family == 0 {
+		r.Family = routeFamily(r)
+	}
+	for _, existing := range b.current.routes {
+		if existing.Table == r.Table && existing.Priority == r.Priority && existing.Family == r.Family && dstEqual(existing.Dst, r.Dst) {
+			return unix.EEXIST
+		}
+	}
+	b.current.routes = append(b.current.routes, r)
+	return nil
+}
+
+// RouteDel removes the route from the current netns. The route is matched by
+// its destination and table, along with its link and gateway if given.
+func (b *Backend) RouteDel(route *netlink.Route) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	table := route.Table
+	if table == 0 {
+		table = unix.RT_TABLE_MAIN
+	}
+	for idx, r := range b.current.routes {
+		if r.Table != table || r.Family != routeFamily(*route) || !dstEqual(r.Dst, route.Dst) {
+			continue
+		}
+		if (route.LinkIndex != 0 && r.LinkIndex != route.LinkIndex) || (route.Gw != nil && !r.Gw.Equal(route.Gw)) {
+			continue
+		}
+		b.current.routes = append(b.current.routes[:idx], b.current.routes[idx+1:]...)
+		return nil
+	}
+	return unix.ESRCH
+}
+
+// RouteList lists the routes of the given family in the main table, via the
+// given link or any link if it is nil.
+func (b *Backend) RouteList(link netlink.Link, family int) ([]netlink.Route, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	index := 0
+	if link != nil {
+		l, err := b.find(link)
+		if err != nil {
+			return nil, err
+		}
+		index = l.Attrs().Index
+	}
+	routes := []netlink.Route{}
+	for _, r := range b.current.routes {
+		if r.Table != unix.RT_TABLE_MAIN || (index != 0 && r.LinkIndex != index) {
+			continue
+		}
+		if family != netlink.FAMILY_ALL && r.Family != family {
+			continue
+		}
+		routes = append(routes, r)
+	}
+	return routes, nil
+}
+
+// routeFamily determines the family of the route from its destination or
+// gateway.
+func routeFamily(r netlink.Route) int {
+	ip := r.Gw
+	if r.Dst != nil {
+		ip = r.Dst.IP
+	}
+	if ip != nil && ip.To4() == nil {
+		return netlink.FAMILY_V6
+	}
+	return netlink.FAMILY_V4
+}
+
+// dstEqual checks if the two route destinations are the same, where a nil or
+// zero length prefix is the default route.
+func dstEqual(a, b *net.IPNet) bool {
+	aOnes, bOnes := 0, 0
+	if a != nil {
+		aOnes, _ = a.Mask.Size()
+	}
+	if b != nil {
+		bOnes, _ = b.Mask.Size()
+	}
+	if aOnes == 0 || bOnes == 0 {
+		return aOnes == bOnes
+	}
+	return aOnes == bOnes && a.IP.Equal(b.IP)
+}
+
+// familyMatches checks if the given ip is of the given family.
+func familyMatches(family int, ip net.IP) bool {
+	switch family {
+	case netlink.FAMILY_V4:
+		return ip.To4() != nil
+	case netlink.FAMILY_V6:
+		return ip.To4() == nil
+	default:
+		return true
+	}
+}
+
+// filter returns the items for which keep is true, reusing the given slice.
+func filter[T any](items []T, keep func(T) bool) []T {
+	kept := items[:0]
+	for _, item := range items {
+		if keep(item) {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+// boolInt converts a bool to the integer form used by link attributes.
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// FouAdd adds a FOU receive port to the current netns.
+func (b *Backend) FouAdd(f netlink.Fou) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, existing := range b.current.fous {
+		if existing.Family == f.Family && existing.Port == f.Port {
+			return unix.EEXIST
+		}
+	}
+	b.current.fous = append(b.current.fous, f)
+	return nil
+}
+
+// FouDel removes a FOU receive port from the current netns.
+func (b *Backend) FouDel(f netlink.Fou) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for idx, existing := range b.current.fous {
+		if existing.Family == f.Family && existing.Port == f.Port {
+			b.current.fous = append(b.current.fous[:idx], b.current.fous[idx+1:]...)
+			return nil
+		}
+	}
+	return unix.ENOENT
+}
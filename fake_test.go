@@ -0,0 +1,376 @@
+package neslink_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/willfantom/neslink"
+	"github.com/willfantom/neslink/fake"
+	"golang.org/x/sys/unix"
+)
+
+const fakeMountDir string = "/run/netns"
+
+// useFake replaces the backend with a new fake for the duration of the test.
+func useFake(t *testing.T) *fake.Backend {
+	t.Helper()
+	b := fake.New()
+	prev := neslink.SetBackend(b)
+	t.Cleanup(func() { neslink.SetBackend(prev) })
+	return b
+}
+
+// fakeLink finds the named link in the fake netns at the given path.
+func fakeLink(t *testing.T, b *fake.Backend, ns neslink.Namespace, name string) netlink.Link {
+	t.Helper()
+	links, err := b.Links(ns)
+	if err != nil {
+		t.Fatalf("failed to list links of %s: %v", ns, err)
+	}
+	for _, l := range links {
+		if l.Attrs().Name == name {
+			return l
+		}
+	}
+	t.Fatalf("link %s not found in %s", name, ns)
+	return nil
+}
+
+func TestFakeDo(t *testing.T) {
+	red := neslink.Namespace(fakeMountDir + "/red")
+	tests := []struct {
+		name    string
+		actions []neslink.Action
+		wantErr bool
+		check   func(t *testing.T, b *fake.Backend)
+	}{
+		{
+			name: "bridge with member",
+			actions: []neslink.Action{
+				neslink.NANewNsAt(fakeMountDir, "red"),
+				neslink.LANewBridge("br0"),
+				neslink.LANewDummy("d0"),
+				neslink.LASetMaster(neslink.LPName("d0"), neslink.LPName("br0")),
+				neslink.LASetMTU(neslink.LPName("br0"), 9000),
+				neslink.LASetUp(neslink.LPName("br0")),
+			},
+			check: func(t *testing.T, b *fake.Backend) {
+				br := fakeLink(t, b, red, "br0")
+				if br.Type() != "bridge" || br.Attrs().MTU != 9000 || br.Attrs().Flags&net.FlagUp == 0 {
+					t.Errorf("unexpected bridge: type %s, mtu %d, flags %v", br.Type(), br.Attrs().MTU, br.Attrs().Flags)
+				}
+				if d := fakeLink(t, b, red, "d0"); d.Attrs().MasterIndex != br.Attrs().Index {
+					t.Errorf("expected d0 to have master %d, got %d", br.Attrs().Index, d.Attrs().MasterIndex)
+				}
+			},
+		},
+		{
+			name: "address and default route",
+			actions: []neslink.Action{
+				neslink.NANewNsAt(fakeMountDir, "red"),
+				neslink.LANewDummy("d0"),
+				neslink.LASetUp(neslink.LPName("d0")),
+				neslink.LAAddAddr(neslink.LPName("d0"), "10.0.0.2/24"),
+				neslink.LAAddRoute(neslink.LPName("d0"), "", "10.0.0.1"),
+			},
+			check: func(t *testing.T, b *fake.Backend) {
+				addrs, _ := b.Addrs(red)
+				if len(addrs) != 1 || addrs[0].IPNet.String() != "10.0.0.2/24" {
+					t.Errorf("unexpected addresses: %v", addrs)
+				}
+				routes, _ := b.Routes(red)
+				if len(routes) != 1 || !routes[0].Gw.Equal(net.ParseIP("10.0.0.1")) {
+					t.Fatalf("unexpected routes: %v", routes)
+				}
+				if ones, _ := routes[0].Dst.Mask.Size(); ones != 0 {
+					t.Errorf("expected a default route, got %s", routes[0].Dst)
+				}
+			},
+		},
+		{
+			name: "delete default route",
+			actions: []neslink.Action{
+				neslink.NANewNsAt(fakeMountDir, "red"),
+				neslink.LANewDummy("d0"),
+				neslink.LASetUp(neslink.LPName("d0")),
+				neslink.LAAddRoute(neslink.LPName("d0"), "", ""),
+				neslink.LADelRoute(neslink.LPName("d0"), "", ""),
+			},
+			check: func(t *testing.T, b *fake.Backend) {
+				if routes, _ := b.Routes(red); len(routes) != 0 {
+					t.Errorf("expected no routes, got %v", routes)
+				}
+			},
+		},
+		{
+			name: "veth peer in missing netns",
+			actions: []neslink.Action{
+				neslink.NANewNsAt(fakeMountDir, "red"),
+				neslink.LANewVethPeerNs(neslink.VethEnd{Name: "v0"}, neslink.VethEnd{Name: "v1"}, neslink.NPNameAt(fakeMountDir, "blue")),
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing link",
+			actions: []neslink.Action{
+				neslink.NANewNsAt(fakeMountDir, "red"),
+				neslink.LASetUp(neslink.LPName("nope")),
+			},
+			wantErr: true,
+		},
+		{
+			name: "ensure veth over a bridge",
+			actions: []neslink.Action{
+				neslink.NANewNsAt(fakeMountDir, "red"),
+				neslink.LANewBridge("br0"),
+				neslink.LAEnsureVeth("br0", "br1"),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := useFake(t)
+			err := neslink.Do(neslink.NPNow(), tt.actions...)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			tt.check(t, b)
+		})
+	}
+}
+
+func TestFakeDoReport(t *testing.T) {
+	useFake(t)
+	results := []neslink.ActionResult{}
+	err := neslink.DoReport(neslink.NPNow(), func(r neslink.ActionResult) {
+		results = append(results, r)
+	},
+		neslink.LANewDummy("d0"),
+		neslink.LANewDummy("d0"),
+		neslink.LASetUp(neslink.LPName("d0")),
+	)
+	if err == nil {
+		t.Fatal("expected an error from the duplicate link")
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if results[0].Err != nil || results[0].Name != "new-dummy" {
+		t.Errorf("unexpected first result: %+v", results[0])
+	}
+	if results[1].Index != 1 || !errors.Is(results[1].Err, unix.EEXIST) {
+		t.Errorf("unexpected second result: %+v", results[1])
+	}
+}
+
+// failingSetNs is a fake backend that fails the next call to SetNs.
+type failingSetNs struct {
+	*fake.Backend
+	fail bool
+}
+
+func (f *failingSetNs) SetNs(fd neslink.NsFd) error {
+	if f.fail {
+		f.fail = false
+		return unix.EINVAL
+	}
+	return f.Backend.SetNs(fd)
+}
+
+func TestFakeDoSetNsFailure(t *testing.T) {
+	b := &failingSetNs{Backend: fake.New(), fail: true}
+	prev := neslink.SetBackend(b)
+	t.Cleanup(func() { neslink.SetBackend(prev) })
+
+	if err := neslink.Do(neslink.NPNow(), neslink.LANewDummy("d0")); err == nil {
+		t.Fatal("expected an error when the netns can not be set")
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- neslink.Do(neslink.NPNow(), neslink.LANewDummy("d0"))
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error after a failed netns switch: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("do did not complete after a failed netns switch")
+	}
+}
+
+func TestFakeNetNsID(t *testing.T) {
+	b := useFake(t)
+	root := neslink.NPPath(b.Root().String())
+	red := neslink.NPNameAt(fakeMountDir, "red")
+	if err := neslink.Do(root, neslink.NANewNsAt(fakeMountDir, "red")); err != nil {
+		t.Fatalf("failed to create netns: %v", err)
+	}
+
+	nsid := 0
+	tests := []struct {
+		name    string
+		action  neslink.Action
+		get     bool
+		want    int
+		wantErr bool
+	}{
+		{name: "unassigned", action: neslink.NAGetNetNsID(red, &nsid), get: true, want: -1},
+		{name: "assign", action: neslink.NASetNetNsID(red, 5)},
+		{name: "assigned", action: neslink.NAGetNetNsID(red, &nsid), get: true, want: 5},
+		{name: "reassign", action: neslink.NASetNetNsID(red, 6), wantErr: true},
+		{name: "still assigned", action: neslink.NAGetNetNsID(red, &nsid), get: true, want: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nsid = 0
+			err := neslink.Do(root, tt.action)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.get && nsid != tt.want {
+				t.Errorf("expected netnsid %d, got %d", tt.want, nsid)
+			}
+		})
+	}
+
+	// a veth with a peer in red refers to it by the assigned netnsid
+	if err := neslink.Do(root, neslink.LANewVethPeerNs(neslink.VethEnd{Name: "v0"}, neslink.VethEnd{Name: "v1"}, red)); err != nil {
+		t.Fatalf("failed to create veth: %v", err)
+	}
+	if got := fakeLink(t, b, b.Root(), "v0").Attrs().NetNsID; got != 5 {
+		t.Errorf("expected veth link-netnsid 5, got %d", got)
+	}
+}
+
+func TestFakeFou(t *testing.T) {
+	b := useFake(t)
+	gue := neslink.FouConfig{Port: 5555, GUE: true}
+	tests := []struct {
+		name    string
+		action  neslink.Action
+		want    int
+		wantErr bool
+	}{
+		{name: "add", action: neslink.NAAddFou(gue), want: 1},
+		{name: "add duplicate", action: neslink.NAAddFou(gue), wantErr: true},
+		{name: "add ipv6", action: neslink.NAAddFou(neslink.FouConfig{Port: 5555, GUE: true, IPv6: true}), want: 2},
+		{name: "delete", action: neslink.NADelFou(gue), want: 1},
+		{name: "delete missing", action: neslink.NADelFou(gue), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := neslink.Do(neslink.NPNow(), tt.action)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if fous, _ := b.Fous(b.Root()); len(fous) != tt.want {
+				t.Errorf("expected %d fou ports, got %v", tt.want, fous)
+			}
+		})
+	}
+}
+
+func TestFakeEnsure(t *testing.T) {
+	d0, d1 := neslink.LPName("d0"), neslink.LPName("d1")
+	linkScope := netlink.SCOPE_LINK
+	tests := []struct {
+		name     string
+		setup    []neslink.Action
+		priority int
+		action   neslink.Action
+		conflict bool
+	}{
+		{name: "new route", action: neslink.LAEnsureRoute(d0, "10.1.0.0/16", "10.0.0.254")},
+		{name: "existing route", setup: []neslink.Action{neslink.LAAddRoute(d0, "10.1.0.0/16", "10.0.0.254")}, action: neslink.LAEnsureRoute(d0, "10.1.0.0/16", "10.0.0.254")},
+		{name: "route without gateway", setup: []neslink.Action{neslink.LAAddRoute(d0, "10.1.0.0/16", "")}, action: neslink.LAEnsureRoute(d0, "10.1.0.0/16", "10.0.0.254"), conflict: true},
+		{name: "route with gateway", setup: []neslink.Action{neslink.LAAddRoute(d0, "10.1.0.0/16", "10.0.0.254")}, action: neslink.LAEnsureRoute(d0, "10.1.0.0/16", ""), conflict: true},
+		{name: "route via other link", setup: []neslink.Action{neslink.LAAddRoute(d1, "10.1.0.0/16", "")}, action: neslink.LAEnsureRoute(d0, "10.1.0.0/16", ""), conflict: true},
+		{name: "route with other priority", priority: 10, action: neslink.LAEnsureRoute(d0, "10.1.0.0/16", ""), conflict: true},
+		{name: "route alongside other priority", priority: 10, setup: []neslink.Action{neslink.LAAddRoute(d0, "10.1.0.0/16", "")}, action: neslink.LAEnsureRoute(d0, "10.1.0.0/16", "")},
+		{name: "existing ipv6 route", setup: []neslink.Action{neslink.LAAddRoute(d0, "2001:db8::/64", "")}, action: neslink.LAEnsureRoute(d0, "2001:db8::/64", "")},
+		{name: "existing address", action: neslink.LAEnsureAddr(d0, "10.0.0.1/24")},
+		{name: "address with other prefix", action: neslink.LAEnsureAddr(d0, "10.0.0.1/16"), conflict: true},
+		{name: "address with other scope", action: neslink.LAEnsureAddrConfig(d0, neslink.AddrConfig{CIDR: "10.0.0.1/24", Scope: &linkScope}), conflict: true},
+		{name: "address with scope", setup: []neslink.Action{neslink.LAAddAddrConfig(d0, neslink.AddrConfig{CIDR: "10.0.0.2/24", Scope: &linkScope})}, action: neslink.LAEnsureAddrConfig(d0, neslink.AddrConfig{CIDR: "10.0.0.2/24", Scope: &linkScope})},
+		{name: "address without flags", setup: []neslink.Action{neslink.LAAddAddr(d0, "2001:db8::1/64")}, action: neslink.LAEnsureAddrConfig(d0, neslink.AddrConfig{CIDR: "2001:db8::1/64", NoDAD: true}), conflict: true},
+		{name: "address with flags", setup: []neslink.Action{neslink.LAAddAddrConfig(d0, neslink.AddrConfig{CIDR: "2001:db8::1/64", NoDAD: true})}, action: neslink.LAEnsureAddrConfig(d0, neslink.AddrConfig{CIDR: "2001:db8::1/64", NoDAD: true})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := useFake(t)
+			if err := neslink.Do(neslink.NPNow(), neslink.LANewDummy("d0"), neslink.LANewDummy("d1"), neslink.LASetUp(d0), neslink.LASetUp(d1), neslink.LAAddAddr(d0, "10.0.0.1/24")); err != nil {
+				t.Fatalf("failed to create links: %v", err)
+			}
+			if tt.priority != 0 {
+				_, dst, _ := net.ParseCIDR("10.1.0.0/16")
+				if err := b.RouteAdd(&netlink.Route{LinkIndex: fakeLink(t, b, b.Root(), "d0").Attrs().Index, Dst: dst, Priority: tt.priority}); err != nil {
+					t.Fatalf("failed to add route: %v", err)
+				}
+			}
+			if err := neslink.Do(neslink.NPNow(), tt.setup...); err != nil {
+				t.Fatalf("failed to set up: %v", err)
+			}
+			err := neslink.Do(neslink.NPNow(), tt.action)
+			if tt.conflict {
+				if !errors.Is(err, neslink.ErrConflict) {
+					t.Fatalf("expected a conflict, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestFakeLinkNotFound(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider neslink.LinkProvider
+	}{
+		{name: "name", provider: neslink.LPName("missing")},
+		{name: "index", provider: neslink.LPIndex(9999)},
+		{name: "alias", provider: neslink.LPAlias("missing")},
+		{name: "altname", provider: neslink.LPAltName("does-not-exist")},
+		{name: "where", provider: neslink.LPWhere(func(netlink.Link) bool { return false })},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFake(t)
+			var link netlink.Link
+			err := neslink.Do(neslink.NPNow(), neslink.NAGetLink(tt.provider, &link))
+			if !errors.Is(err, neslink.ErrLinkNotFound) {
+				t.Fatalf("expected an error matching ErrLinkNotFound, got %v", err)
+			}
+			// a matched netlink error must be usable
+			var nf netlink.LinkNotFoundError
+			if errors.As(err, &nf) && nf.Error() == "" {
+				t.Error("expected the matched netlink error to have a message")
+			}
+		})
+	}
+}
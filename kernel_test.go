@@ -0,0 +1,426 @@
+package neslink_test
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/willfantom/neslink"
+	"github.com/willfantom/neslink/neslinktest"
+	"golang.org/x/sys/unix"
+)
+
+// newNs creates a named netns for the test, returning a provider for it.
+func newNs(t *testing.T, name string) neslink.NsProvider {
+	t.Helper()
+	neslinktest.Require(t)
+	dir := neslinktest.MountDir(t)
+	if err := neslink.Do(neslink.NPNow(), neslink.NANewNsAt(dir, name)); err != nil {
+		t.Fatalf("failed to create netns %s: %v", name, err)
+	}
+	return neslink.NPNameAt(dir, name)
+}
+
+// getLink gets the link from the given provider in the given netns.
+func getLink(t *testing.T, nsP neslink.NsProvider, lP neslink.LinkProvider) netlink.Link {
+	t.Helper()
+	var link netlink.Link
+	if err := neslink.Do(nsP, neslink.NAGetLink(lP, &link)); err != nil {
+		t.Fatalf("failed to get link: %v", err)
+	}
+	return link
+}
+
+// skipUnsupported skips the test if the error shows that links of the given
+// type are not supported by the kernel (such as when the module is missing).
+func skipUnsupported(t *testing.T, err error, linkType string) {
+	t.Helper()
+	if errors.Is(err, unix.EOPNOTSUPP) {
+		t.Skipf("%s links are not supported by the kernel: %v", linkType, err)
+	}
+}
+
+func TestDo(t *testing.T) {
+	tests := []struct {
+		name    string
+		actions []neslink.Action
+		wantErr bool
+	}{
+		{name: "no actions"},
+		{name: "link actions", actions: []neslink.Action{neslink.LANewBridge("br0"), neslink.LASetUp(neslink.LPName("br0"))}},
+		{name: "failing action", actions: []neslink.Action{neslink.LASetUp(neslink.LPName("br0"))}, wantErr: true},
+		{name: "stops at failure", actions: []neslink.Action{neslink.LANewBridge("br0"), neslink.LANewBridge("br0"), neslink.LADelete(neslink.LPName("br0"))}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nsP := newNs(t, "do")
+			err := neslink.Do(nsP, tt.actions...)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	t.Run("missing netns", func(t *testing.T) {
+		neslinktest.Require(t)
+		if err := neslink.Do(neslink.NPPath(filepath.Join(t.TempDir(), "missing"))); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("returns to origin netns", func(t *testing.T) {
+		nsP := newNs(t, "do")
+		before, err := neslink.NPNow().Provide()
+		if err != nil {
+			t.Fatalf("failed to get current netns: %v", err)
+		}
+		if err := neslink.Do(nsP, neslink.LANewBridge("br0")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var link netlink.Link
+		if err := neslink.Do(neslink.NPPath(before.String()), neslink.NAGetLink(neslink.LPName("br0"), &link)); err == nil {
+			t.Error("expected the link to only exist in the target netns")
+		}
+	})
+}
+
+func TestNANewNsAt(t *testing.T) {
+	neslinktest.Require(t)
+	dir := neslinktest.MountDir(t)
+	tests := []struct {
+		name    string
+		action  neslink.NsAction
+		exists  bool
+		wantErr bool
+	}{
+		{name: "create", action: neslink.NANewNsAt(dir, "red"), exists: true},
+		{name: "create duplicate", action: neslink.NANewNsAt(dir, "red"), exists: true, wantErr: true},
+		{name: "ensure existing", action: neslink.NAEnsureNsAt(dir, "red"), exists: true},
+		{name: "delete", action: neslink.NADeleteNamedAt(dir, "red")},
+		{name: "delete missing", action: neslink.NADeleteNamedAt(dir, "red"), wantErr: true},
+		{name: "ensure new", action: neslink.NAEnsureNsAt(dir, "red"), exists: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := neslink.Do(neslink.NPNow(), tt.action)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			_, err = os.Stat(filepath.Join(dir, "red"))
+			if tt.exists != (err == nil) {
+				t.Errorf("expected netns to exist %v, got stat error %v", tt.exists, err)
+			}
+		})
+	}
+
+	t.Run("actions run in new netns", func(t *testing.T) {
+		if err := neslink.Do(neslink.NPNow(), neslink.NANewNsAt(dir, "blue"), neslink.LANewBridge("br0")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		getLink(t, neslink.NPNameAt(dir, "blue"), neslink.LPName("br0"))
+	})
+}
+
+func TestNASetLinkNs(t *testing.T) {
+	tests := []struct {
+		name    string
+		link    neslink.LinkProvider
+		wantErr bool
+	}{
+		{name: "by name", link: neslink.LPName("v0")},
+		{name: "by peer", link: neslink.LPVethPeer(neslink.LPName("v1"))},
+		{name: "missing link", link: neslink.LPName("v2"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := newNs(t, "src")
+			dst := newNs(t, "dst")
+			if err := neslink.Do(src, neslink.LANewVeth("v0", "v1")); err != nil {
+				t.Fatalf("failed to create link: %v", err)
+			}
+			err := neslink.Do(src, neslink.NASetLinkNs(tt.link, dst))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			getLink(t, dst, neslink.LPName("v0"))
+		})
+	}
+}
+
+func TestLACreate(t *testing.T) {
+	tests := []struct {
+		name     string
+		action   neslink.LinkAction
+		link     string
+		linkType string
+		wantErr  bool
+	}{
+		{name: "bridge", action: neslink.LANewBridge("br0"), link: "br0", linkType: "bridge"},
+		{name: "dummy", action: neslink.LANewDummy("d0"), link: "d0", linkType: "dummy"},
+		{name: "veth", action: neslink.LANewVeth("v0", "v1"), link: "v1", linkType: "veth"},
+		{name: "tap", action: neslink.LANewTuntap("tap0", neslink.TuntapConfig{Mode: netlink.TUNTAP_MODE_TAP, Persist: true}, nil), link: "tap0", linkType: "tuntap"},
+		{name: "vxlan", action: neslink.LANewVxlan("vx0", "10.0.0.1", "10.0.0.2", 42, 4789), link: "vx0", linkType: "vxlan"},
+		{name: "gretap", action: neslink.LANewGRETap("gt0", "10.0.0.1", "10.0.0.2"), link: "gt0", linkType: "gretap"},
+		{name: "ipip", action: neslink.LANewIPIP("ipip0", neslink.TunnelConfig{Remote: net.ParseIP("10.0.0.2")}), link: "ipip0", linkType: "ipip"},
+		{name: "geneve", action: neslink.LANewGeneve("gnv0", neslink.GeneveConfig{TunnelConfig: neslink.TunnelConfig{Remote: net.ParseIP("10.0.0.2")}, VNI: 42}), link: "gnv0", linkType: "geneve"},
+		{name: "geneve with local", action: neslink.LANewGeneve("gnv0", neslink.GeneveConfig{TunnelConfig: neslink.TunnelConfig{Local: net.ParseIP("10.0.0.1"), Remote: net.ParseIP("10.0.0.2")}}), wantErr: true},
+		{name: "invalid name", action: neslink.LANewBridge("this-name-is-too-long"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nsP := newNs(t, "create")
+			err := neslink.Do(nsP, tt.action)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			skipUnsupported(t, err, tt.linkType)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if link := getLink(t, nsP, neslink.LPName(tt.link)); link.Type() != tt.linkType {
+				t.Errorf("expected link type %s, got %s", tt.linkType, link.Type())
+			}
+		})
+	}
+}
+
+func TestLASet(t *testing.T) {
+	tests := []struct {
+		name    string
+		action  neslink.LinkAction
+		check   func(netlink.Link) bool
+		wantErr bool
+	}{
+		{name: "mtu", action: neslink.LASetMTU(neslink.LPName("v0"), 1400), check: func(l netlink.Link) bool { return l.Attrs().MTU == 1400 }},
+		{name: "name", action: neslink.LASetName(neslink.LPName("v0"), "v2"), check: func(l netlink.Link) bool { return l.Attrs().Name == "v2" }},
+		{name: "alias", action: neslink.LASetAlias(neslink.LPName("v0"), "veth zero"), check: func(l netlink.Link) bool { return l.Attrs().Alias == "veth zero" }},
+		{name: "hardware address", action: neslink.LASetHw(neslink.LPName("v0"), "02:00:00:00:00:01"), check: func(l netlink.Link) bool { return l.Attrs().HardwareAddr.String() == "02:00:00:00:00:01" }},
+		{name: "up", action: neslink.LASetUp(neslink.LPName("v0")), check: func(l netlink.Link) bool { return l.Attrs().Flags&net.FlagUp != 0 }},
+		{name: "down", action: neslink.LASetDown(neslink.LPName("v0")), check: func(l netlink.Link) bool { return l.Attrs().Flags&net.FlagUp == 0 }},
+		{name: "master", action: neslink.LASetMaster(neslink.LPName("v0"), neslink.LPName("br0")), check: func(l netlink.Link) bool { return l.Attrs().MasterIndex != 0 }},
+		{name: "no master", action: neslink.LASetNoMaster(neslink.LPName("v0")), check: func(l netlink.Link) bool { return l.Attrs().MasterIndex == 0 }},
+		{name: "settings", action: neslink.LASet(neslink.LPName("v0"), neslink.LinkSettings{MTU: neslink.Ptr(1300), TxQLen: neslink.Ptr(10)}), check: func(l netlink.Link) bool { return l.Attrs().MTU == 1300 && l.Attrs().TxQLen == 10 }},
+		{name: "invalid hardware address", action: neslink.LASetHw(neslink.LPName("v0"), "zz"), wantErr: true},
+		{name: "missing master", action: neslink.LASetMaster(neslink.LPName("v0"), neslink.LPName("br1")), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nsP := newNs(t, "set")
+			if err := neslink.Do(nsP, neslink.LANewVeth("v0", "v1"), neslink.LANewBridge("br0")); err != nil {
+				t.Fatalf("failed to create links: %v", err)
+			}
+			index := getLink(t, nsP, neslink.LPName("v0")).Attrs().Index
+			err := neslink.Do(nsP, tt.action)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if link := getLink(t, nsP, neslink.LPIndex(index)); !tt.check(link) {
+				t.Errorf("link not set as expected: %+v", link.Attrs())
+			}
+		})
+	}
+}
+
+func TestLAAddr(t *testing.T) {
+	tests := []struct {
+		name    string
+		actions []neslink.Action
+		want    []string
+		wantErr bool
+	}{
+		{name: "add", actions: []neslink.Action{neslink.LAAddAddr(neslink.LPName("v0"), "10.0.0.1/24")}, want: []string{"10.0.0.1/24"}},
+		{name: "add duplicate", actions: []neslink.Action{neslink.LAAddAddr(neslink.LPName("v0"), "10.0.0.1/24"), neslink.LAAddAddr(neslink.LPName("v0"), "10.0.0.1/24")}, wantErr: true},
+		{name: "ensure duplicate", actions: []neslink.Action{neslink.LAAddAddr(neslink.LPName("v0"), "10.0.0.1/24"), neslink.LAEnsureAddr(neslink.LPName("v0"), "10.0.0.1/24")}, want: []string{"10.0.0.1/24"}},
+		{name: "delete", actions: []neslink.Action{neslink.LAAddAddr(neslink.LPName("v0"), "10.0.0.1/24"), neslink.LADelAddr(neslink.LPName("v0"), "10.0.0.1/24")}},
+		{name: "delete missing", actions: []neslink.Action{neslink.LADelAddr(neslink.LPName("v0"), "10.0.0.1/24")}, wantErr: true},
+		{name: "flush", actions: []neslink.Action{neslink.LAAddAddr(neslink.LPName("v0"), "10.0.0.1/24"), neslink.LAAddAddr(neslink.LPName("v0"), "10.0.1.1/24"), neslink.LAFlushAddrs(neslink.LPName("v0"), netlink.FAMILY_V4)}},
+		{name: "invalid cidr", actions: []neslink.Action{neslink.LAAddAddr(neslink.LPName("v0"), "10.0.0.1")}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nsP := newNs(t, "addr")
+			if err := neslink.Do(nsP, neslink.LANewVeth("v0", "v1")); err != nil {
+				t.Fatalf("failed to create link: %v", err)
+			}
+			err := neslink.Do(nsP, tt.actions...)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			addrs := []netlink.Addr{}
+			if err := neslink.Do(nsP, neslink.LAGetAddrs(neslink.LPName("v0"), netlink.FAMILY_V4, &addrs)); err != nil {
+				t.Fatalf("failed to get addresses: %v", err)
+			}
+			got := []string{}
+			for _, a := range addrs {
+				got = append(got, a.IPNet.String())
+			}
+			if len(got) != len(tt.want) || (len(got) > 0 && got[0] != tt.want[0]) {
+				t.Errorf("expected addresses %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLARoute(t *testing.T) {
+	v0 := neslink.LPName("v0")
+	tests := []struct {
+		name    string
+		actions []neslink.Action
+		dst     string
+		exists  bool
+		wantErr bool
+	}{
+		{name: "add", actions: []neslink.Action{neslink.LAAddRoute(v0, "10.1.0.0/16", "10.0.0.254")}, dst: "10.1.0.0/16", exists: true},
+		{name: "add default", actions: []neslink.Action{neslink.LAAddRoute(v0, "", "10.0.0.254")}, dst: "default", exists: true},
+		{name: "ensure duplicate", actions: []neslink.Action{neslink.LAAddRoute(v0, "10.1.0.0/16", ""), neslink.LAEnsureRoute(v0, "10.1.0.0/16", "")}, dst: "10.1.0.0/16", exists: true},
+		{name: "ensure duplicate ipv6", actions: []neslink.Action{neslink.LAAddRoute(v0, "2001:db8::/64", ""), neslink.LAEnsureRoute(v0, "2001:db8::/64", "")}, dst: "2001:db8::/64", exists: true},
+		{name: "ensure with other gateway", actions: []neslink.Action{neslink.LAAddRoute(v0, "10.1.0.0/16", "10.0.0.254"), neslink.LAEnsureRoute(v0, "10.1.0.0/16", "10.0.0.253")}, wantErr: true},
+		{name: "ensure without gateway", actions: []neslink.Action{neslink.LAAddRoute(v0, "10.1.0.0/16", "10.0.0.254"), neslink.LAEnsureRoute(v0, "10.1.0.0/16", "")}, wantErr: true},
+		{name: "delete", actions: []neslink.Action{neslink.LAAddRoute(v0, "10.1.0.0/16", ""), neslink.LADelRoute(v0, "10.1.0.0/16", "")}, dst: "10.1.0.0/16"},
+		{name: "delete default", actions: []neslink.Action{neslink.LAAddRoute(v0, "", "10.0.0.254"), neslink.LADelRoute(v0, "", "10.0.0.254")}, dst: "default"},
+		{name: "unreachable gateway", actions: []neslink.Action{neslink.LAAddRoute(v0, "10.1.0.0/16", "192.168.0.1")}, wantErr: true},
+		{name: "invalid destination", actions: []neslink.Action{neslink.LAAddRoute(v0, "10.1.0.0", "")}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nsP := newNs(t, "route")
+			if err := neslink.Do(nsP, neslink.LANewVeth("v0", "v1"), neslink.LASetUp(v0), neslink.LASetUp(neslink.LPName("v1")), neslink.LAAddAddr(v0, "10.0.0.1/24")); err != nil {
+				t.Fatalf("failed to create link: %v", err)
+			}
+			err := neslink.Do(nsP, tt.actions...)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			err = neslink.Do(nsP, neslink.NAWaitRoute(tt.dst, 100*time.Millisecond))
+			if tt.exists != (err == nil) {
+				t.Errorf("expected route to %s to exist %v, got %v", tt.dst, tt.exists, err)
+			}
+		})
+	}
+}
+
+func TestLAWait(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   []neslink.Action
+		action  neslink.LinkAction
+		wantErr bool
+	}{
+		{name: "exists", setup: []neslink.Action{neslink.LANewBridge("br0")}, action: neslink.LAWaitExists(neslink.LPName("br0"), time.Second)},
+		{name: "exists timeout", action: neslink.LAWaitExists(neslink.LPName("br0"), 100*time.Millisecond), wantErr: true},
+		{name: "addr", setup: []neslink.Action{neslink.LANewBridge("br0"), neslink.LAAddAddr(neslink.LPName("br0"), "10.0.0.1/24")}, action: neslink.LAWaitAddr(neslink.LPName("br0"), "10.0.0.1/24", time.Second)},
+		{name: "addr timeout", setup: []neslink.Action{neslink.LANewBridge("br0")}, action: neslink.LAWaitAddr(neslink.LPName("br0"), "10.0.0.1/24", 100*time.Millisecond), wantErr: true},
+		{name: "carrier", setup: []neslink.Action{neslink.LANewVeth("v0", "v1"), neslink.LASetUp(neslink.LPName("v0")), neslink.LASetUp(neslink.LPName("v1"))}, action: neslink.LAWaitCarrier(neslink.LPName("v0"), 5*time.Second)},
+		{name: "carrier timeout", setup: []neslink.Action{neslink.LANewVeth("v0", "v1"), neslink.LASetUp(neslink.LPName("v0"))}, action: neslink.LAWaitCarrier(neslink.LPName("v0"), 100*time.Millisecond), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nsP := newNs(t, "wait")
+			if err := neslink.Do(nsP, tt.setup...); err != nil {
+				t.Fatalf("failed to set up links: %v", err)
+			}
+			err := neslink.Do(nsP, tt.action)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLAEnsure(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    []neslink.Action
+		action   neslink.LinkAction
+		linkType string
+		wantErr  bool
+	}{
+		{name: "new bridge", action: neslink.LAEnsureBridge("br0")},
+		{name: "existing bridge", setup: []neslink.Action{neslink.LANewBridge("br0")}, action: neslink.LAEnsureBridge("br0")},
+		{name: "bridge over veth", setup: []neslink.Action{neslink.LANewVeth("br0", "br1")}, action: neslink.LAEnsureBridge("br0"), wantErr: true},
+		{name: "new dummy", action: neslink.LAEnsureDummy("d0"), linkType: "dummy"},
+		{name: "existing dummy", setup: []neslink.Action{neslink.LANewDummy("d0")}, action: neslink.LAEnsureDummy("d0"), linkType: "dummy"},
+		{name: "new veth", action: neslink.LAEnsureVeth("v0", "v1")},
+		{name: "existing veth", setup: []neslink.Action{neslink.LANewVeth("v0", "v1")}, action: neslink.LAEnsureVeth("v0", "v1")},
+		{name: "veth with other peer", setup: []neslink.Action{neslink.LANewVeth("v0", "v2")}, action: neslink.LAEnsureVeth("v0", "v1"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nsP := newNs(t, "ensure")
+			if err := neslink.Do(nsP, tt.setup...); err != nil {
+				skipUnsupported(t, err, tt.linkType)
+				t.Fatalf("failed to set up links: %v", err)
+			}
+			err := neslink.Do(nsP, tt.action)
+			skipUnsupported(t, err, tt.linkType)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLinkNotFound(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider neslink.LinkProvider
+	}{
+		{name: "name", provider: neslink.LPName("missing")},
+		{name: "index", provider: neslink.LPIndex(9999)},
+		{name: "alias", provider: neslink.LPAlias("missing")},
+		{name: "hardware address", provider: neslink.LPHardwareAddr("02:00:00:00:00:99")},
+		{name: "altname", provider: neslink.LPAltName("does-not-exist")},
+		{name: "type", provider: neslink.LPType("vxlan")},
+		{name: "master of", provider: neslink.LPMasterOf(neslink.LPName("br0"))},
+		{name: "where", provider: neslink.LPWhere(func(netlink.Link) bool { return false })},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nsP := newNs(t, "notfound")
+			if err := neslink.Do(nsP, neslink.LANewBridge("br0")); err != nil {
+				t.Fatalf("failed to create link: %v", err)
+			}
+			var link netlink.Link
+			err := neslink.Do(nsP, neslink.NAGetLink(tt.provider, &link))
+			if !errors.Is(err, neslink.ErrLinkNotFound) {
+				t.Fatalf("expected an error matching ErrLinkNotFound, got %v", err)
+			}
+			// a matched netlink error must be usable
+			var nf netlink.LinkNotFoundError
+			if errors.As(err, &nf) && nf.Error() == "" {
+				t.Error("expected the matched netlink error to have a message")
+			}
+		})
+	}
+}
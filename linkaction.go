@@ -1,14 +1,25 @@
 package neslink
 
-// TODO: Document all link actions
-// TODO: Link actions for adding/deleting routes
-
 import (
 	"errors"
 	"fmt"
+	"math"
 	"net"
+	"os"
+	"time"
 
 	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// ip6DefaultMetric is the priority the kernel gives IPv6 routes that are
+	// added without one.
+	ip6DefaultMetric int = 1024
+)
+
+var (
+	errDADFailed error = errors.New("duplicate address detection failed")
 )
 
 // LinkAction is a singular operation that can be performed on a generic netlink
@@ -21,6 +32,7 @@ import (
 type LinkAction struct {
 	actionName string
 	f          func() error
+	desc       Descriptor
 }
 
 // ActionName returns the name associated with the given link action.
@@ -50,16 +62,40 @@ func LAGeneric(actionName string, provider LinkProvider, function func() error)
 	}
 }
 
+// LAForEach performs the link action created by the given function on every
+// link obtained from the links provider. Each link is given to the function
+// as a provider for the index of the link, so for example LASetUp can be used
+// directly. Execution stops at the first action to fail.
+func LAForEach(provider LinksProvider, action func(LinkProvider) LinkAction) LinkAction {
+	return LinkAction{
+		actionName: "for-each",
+		f: func() error {
+			links, err := provider.Provide()
+			if err != nil {
+				return errors.Join(errNoLinks, err)
+			}
+			for _, l := range links {
+				la := action(LPIndex(l.Attrs().Index))
+				if err := la.act(); err != nil {
+					return fmt.Errorf("failed to perform action %s on link %s: %w", la.name(), l.Attrs().Name, err)
+				}
+			}
+			return nil
+		},
+	}
+}
+
 // LANewBridge creates a new bridge with the given name.
 func LANewBridge(name string) LinkAction {
 	return LinkAction{
 		actionName: "new-bridge",
+		desc:       NewDescriptor("LANewBridge", name),
 		f: func() error {
 			bridge := netlink.Bridge{
 				LinkAttrs: netlink.NewLinkAttrs(),
 			}
 			bridge.LinkAttrs.Name = name
-			return netlink.LinkAdd(&bridge)
+			return backend.LinkAdd(&bridge)
 		},
 	}
 }
@@ -69,27 +105,149 @@ func LANewBridge(name string) LinkAction {
 func LANewVeth(name, peerName string) LinkAction {
 	return LinkAction{
 		actionName: "new-veth",
+		desc:       NewDescriptor("LANewVeth", name, peerName),
 		f: func() error {
 			veth := netlink.Veth{
 				LinkAttrs: netlink.NewLinkAttrs(),
 				PeerName:  peerName,
 			}
 			veth.LinkAttrs.Name = name
-			return netlink.LinkAdd(&veth)
+			return backend.LinkAdd(&veth)
+		},
+	}
+}
+
+// VethEnd describes the configuration of a single end of a veth pair. Only the
+// fields that are set are applied, with the exception of Name which is always
+// required. Addresses should be given in CIDR notation.
+type VethEnd struct {
+	Name         string
+	HardwareAddr string
+	MTU          int
+	Addrs        []string
+	Up           bool
+}
+
+// LANewVethPeerNs will create a new veth pair with the peer end created
+// directly in the netns obtained from the given provider. Both ends are then
+// configured as described, meaning a point-to-point link between two
+// namespaces can be created and addressed in a single action. The peer never
+// appears in the netns this is called in. If configuring either end fails, the
+// pair is deleted.
+func LANewVethPeerNs(local, peer VethEnd, peerNs NsProvider) LinkAction {
+	return LinkAction{
+		actionName: "new-veth-peer-ns",
+		desc:       NewDescriptor("LANewVethPeerNs", local, peer, peerNs),
+		f: func() error {
+			// 1. parse the configuration of both ends before creating anything
+			localAddrs, err := parseAddrs(local.Addrs)
+			if err != nil {
+				return err
+			}
+			peerAddrs, err := parseAddrs(peer.Addrs)
+			if err != nil {
+				return err
+			}
+			veth := netlink.Veth{
+				LinkAttrs: netlink.NewLinkAttrs(),
+				PeerName:  peer.Name,
+			}
+			veth.LinkAttrs.Name = local.Name
+			veth.LinkAttrs.MTU = local.MTU
+			if local.HardwareAddr != "" {
+				if veth.LinkAttrs.HardwareAddr, err = net.ParseMAC(local.HardwareAddr); err != nil {
+					return fmt.Errorf("failed to parse the hardware address of the veth: %w", err)
+				}
+			}
+			if peer.HardwareAddr != "" {
+				if veth.PeerHardwareAddr, err = net.ParseMAC(peer.HardwareAddr); err != nil {
+					return fmt.Errorf("failed to parse the hardware address of the veth peer: %w", err)
+				}
+			}
+
+			// 2. open the netns for the peer
+			ns, err := peerNs.Provide()
+			if err != nil {
+				return errors.Join(errNoNs, err)
+			}
+			nsfd, err := backend.OpenNs(ns)
+			if err != nil {
+				return fmt.Errorf("failed to open the netns for the veth peer: %w", err)
+			}
+			defer backend.CloseNs(nsfd)
+			veth.PeerNamespace = netlink.NsFd(nsfd.Int())
+
+			// 3. create the pair
+			if err := backend.LinkAdd(&veth); err != nil {
+				return err
+			}
+
+			// 4. configure both ends, removing the pair on failure
+			if err := configureVethEnd(local, localAddrs); err != nil {
+				return errors.Join(err, backend.LinkDel(&veth))
+			}
+			if err := inNs(nsfd, func() error {
+				return configureVethEnd(peer, peerAddrs)
+			}); err != nil {
+				if errors.Is(err, errDirtyThread) {
+					return err
+				}
+				return errors.Join(err, backend.LinkDel(&veth))
+			}
+			return nil
 		},
 	}
 }
 
+// configureVethEnd applies the MTU, addresses and state of the given veth end
+// in the netns this is called in.
+func configureVethEnd(end VethEnd, addrs []*netlink.Addr) error {
+	l, err := backend.LinkByName(end.Name)
+	if err != nil {
+		return fmt.Errorf("failed to find veth end %s: %w", end.Name, err)
+	}
+	if end.MTU > 0 && l.Attrs().MTU != end.MTU {
+		if err := backend.LinkSetMTU(l, end.MTU); err != nil {
+			return fmt.Errorf("failed to set the mtu of veth end %s: %w", end.Name, err)
+		}
+	}
+	for _, addr := range addrs {
+		if err := backend.AddrAdd(l, addr); err != nil {
+			return fmt.Errorf("failed to add address %s to veth end %s: %w", addr.IPNet, end.Name, err)
+		}
+	}
+	if end.Up {
+		if err := backend.LinkSetUp(l); err != nil {
+			return fmt.Errorf("failed to set veth end %s up: %w", end.Name, err)
+		}
+	}
+	return nil
+}
+
+// parseAddrs parses each of the given cidrs into a network address.
+func parseAddrs(cidrs []string) ([]*netlink.Addr, error) {
+	addrs := make([]*netlink.Addr, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		addr, err := netlink.ParseAddr(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse cidr to network address: %w", err)
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
 // LANewDummy creates a new dummy link with the given name.
 func LANewDummy(name string) LinkAction {
 	return LinkAction{
 		actionName: "new-dummy",
+		desc:       NewDescriptor("LANewDummy", name),
 		f: func() error {
 			dummy := netlink.Dummy{
 				LinkAttrs: netlink.NewLinkAttrs(),
 			}
 			dummy.LinkAttrs.Name = name
-			return netlink.LinkAdd(&dummy)
+			return backend.LinkAdd(&dummy)
 		},
 	}
 }
@@ -99,6 +257,7 @@ func LANewDummy(name string) LinkAction {
 func LANewGRETap(name, localIP, remoteIP string) LinkAction {
 	return LinkAction{
 		actionName: "new-gretap",
+		desc:       NewDescriptor("LANewGRETap", name, localIP, remoteIP),
 		f: func() error {
 			local := net.ParseIP(localIP)
 			if local == nil {
@@ -114,23 +273,91 @@ func LANewGRETap(name, localIP, remoteIP string) LinkAction {
 				Remote:    remote,
 			}
 			gre.LinkAttrs.Name = name
-			return netlink.LinkAdd(&gre)
+			return backend.LinkAdd(&gre)
+		},
+	}
+}
+
+// TuntapConfig describes a tun or tap device. Mode should be either
+// netlink.TUNTAP_MODE_TUN or netlink.TUNTAP_MODE_TAP. If MultiQueue is set,
+// Queues queues are opened (at least 1), otherwise a single queue is opened.
+// Unless PacketInfo is set, packets are read and written without the packet
+// information header. If Persist is not set, the device is removed once all
+// its queues are closed. Owner and Group set the user and group that may
+// attach to a persistent device.
+type TuntapConfig struct {
+	Mode       netlink.TuntapMode
+	MultiQueue bool
+	Queues     int
+	Persist    bool
+	VnetHdr    bool
+	PacketInfo bool
+	Owner      uint32
+	Group      uint32
+}
+
+// LANewTuntap creates a new tun or tap device with the given name and
+// configuration in the netns this is called in. The open queues of the device
+// are stored in the given queues parameter (if not nil), and remain usable
+// after the enclosing Do call returns, regardless of the netns of the reading
+// or writing goroutine. It is up to the caller to close the queues. If queues
+// is nil, they are closed immediately, so the device should be persistent.
+func LANewTuntap(name string, config TuntapConfig, queues *[]*os.File) LinkAction {
+	return LinkAction{
+		actionName: "new-tuntap",
+		desc:       NewDescriptor("LANewTuntap", name, config),
+		f: func() error {
+			tuntap := netlink.Tuntap{
+				LinkAttrs:  netlink.NewLinkAttrs(),
+				Mode:       config.Mode,
+				NonPersist: !config.Persist,
+				Queues:     1,
+				Owner:      config.Owner,
+				Group:      config.Group,
+			}
+			tuntap.LinkAttrs.Name = name
+			// netlink uses its own defaults when no flags are given, so the
+			// single queue flag (a no-op in modern kernels) is always included
+			tuntap.Flags = netlink.TUNTAP_ONE_QUEUE
+			if config.MultiQueue {
+				tuntap.Flags = netlink.TUNTAP_MULTI_QUEUE
+				if config.Queues > 1 {
+					tuntap.Queues = config.Queues
+				}
+			}
+			if !config.PacketInfo {
+				tuntap.Flags |= netlink.TUNTAP_NO_PI
+			}
+			if config.VnetHdr {
+				tuntap.Flags |= netlink.TUNTAP_VNET_HDR
+			}
+			if err := backend.LinkAdd(&tuntap); err != nil {
+				return err
+			}
+			if queues == nil {
+				for _, q := range tuntap.Fds {
+					q.Close()
+				}
+				return nil
+			}
+			*queues = tuntap.Fds
+			return nil
 		},
 	}
 }
 
 // LANewWireguard creates a new wireguard link with the given name. Further
-// setup of this link should be done in custom LinkActions with wireguard
-// specifc code.
+// setup of this link can be done via the actions in the wireguard package.
 func LANewWireguard(name string) LinkAction {
 	return LinkAction{
 		actionName: "new-wireguard",
+		desc:       NewDescriptor("LANewWireguard", name),
 		f: func() error {
 			wg := netlink.Wireguard{
 				LinkAttrs: netlink.NewLinkAttrs(),
 			}
 			wg.LinkAttrs.Name = name
-			return netlink.LinkAdd(&wg)
+			return backend.LinkAdd(&wg)
 		},
 	}
 }
@@ -139,6 +366,7 @@ func LANewWireguard(name string) LinkAction {
 func LANewVxlan(name, localIP, groupIP string, id, port int) LinkAction {
 	return LinkAction{
 		actionName: "new-vxlan",
+		desc:       NewDescriptor("LANewVxlan", name, localIP, groupIP, id, port),
 		f: func() error {
 			local := net.ParseIP(localIP)
 			if local == nil {
@@ -156,7 +384,274 @@ func LANewVxlan(name, localIP, groupIP string, id, port int) LinkAction {
 				Port:      port,
 			}
 			vx.LinkAttrs.Name = name
-			return netlink.LinkAdd(&vx)
+			return backend.LinkAdd(&vx)
+		},
+	}
+}
+
+// TunnelEncap describes the UDP encapsulation (FOU or GUE) of an IP tunnel. A
+// matching receive port should be configured on the remote end via NAAddFou.
+// If the source port is 0, the kernel picks one based on a flow hash.
+type TunnelEncap struct {
+	Type       netlink.TunnelEncapType
+	Sport      uint16
+	Dport      uint16
+	Csum       bool
+	RemoteCsum bool
+}
+
+// TunnelConfig describes the configuration common to IP tunnel links. Remote
+// is required, whilst Local may be left unset to use any local address. If an
+// underlay link provider is given, the tunnel is bound to that link. A TTL of
+// 0 inherits the TTL of the inner packet, and path MTU discovery is enabled
+// unless NoPMTUDisc is set.
+type TunnelConfig struct {
+	Local      net.IP
+	Remote     net.IP
+	Underlay   *LinkProvider
+	TTL        uint8
+	TOS        uint8
+	NoPMTUDisc bool
+	Encap      *TunnelEncap
+}
+
+// GREConfig describes the configuration of a GRE tunnel. A non-zero input or
+// output key enables keyed GRE in that direction.
+type GREConfig struct {
+	TunnelConfig
+	IKey uint32
+	OKey uint32
+}
+
+// GeneveConfig describes the configuration of a Geneve tunnel. If the port is
+// 0, the IANA assigned port 6081 is used. Geneve tunnels can not be bound to a
+// local address or an underlay link, nor use FOU or GUE encapsulation, and so
+// Local, Underlay and Encap must not be set. Path MTU discovery is supported by
+// setting the don't fragment bit of the encapsulating packets.
+type GeneveConfig struct {
+	TunnelConfig
+	VNI  uint32
+	Port uint16
+}
+
+// tunnelAttrs holds the attributes of a TunnelConfig in the form used by the
+// netlink tunnel link types.
+type tunnelAttrs struct {
+	local      net.IP
+	remote     net.IP
+	link       uint32
+	pmtudisc   uint8
+	encapType  uint16
+	encapFlags uint16
+	encapSport uint16
+	encapDport uint16
+}
+
+// attrs validates the tunnel config and resolves the underlay link (in the
+// namespace this is called in). If wantV4 is not nil, the family of the remote
+// address must match it.
+func (tc TunnelConfig) attrs(wantV4 *bool) (tunnelAttrs, error) {
+	ta := tunnelAttrs{
+		local:  tc.Local,
+		remote: tc.Remote,
+	}
+	if tc.Remote == nil {
+		return ta, fmt.Errorf("the remote ip address of the tunnel is required")
+	}
+	remoteV4 := tc.Remote.To4() != nil
+	if tc.Local != nil && (tc.Local.To4() != nil) != remoteV4 {
+		return ta, fmt.Errorf("the local and remote ip addresses of the tunnel must be of the same family")
+	}
+	if wantV4 != nil && *wantV4 != remoteV4 {
+		return ta, fmt.Errorf("the ip addresses of the tunnel are of the wrong family for the tunnel type")
+	}
+	if tc.Local == nil && remoteV4 {
+		// the netlink tunnel types use the local address to determine family
+		ta.local = net.IPv4zero
+	}
+	if tc.Underlay != nil {
+		l, err := tc.Underlay.Provide()
+		if err != nil {
+			return ta, fmt.Errorf("failed to get the underlay link of the tunnel: %w", err)
+		}
+		ta.link = uint32(l.Attrs().Index)
+	}
+	if !tc.NoPMTUDisc {
+		ta.pmtudisc = 1
+	}
+	if tc.Encap != nil {
+		ta.encapType = uint16(tc.Encap.Type)
+		ta.encapSport = tc.Encap.Sport
+		ta.encapDport = tc.Encap.Dport
+		if tc.Encap.Csum {
+			ta.encapFlags |= uint16(netlink.CSum)
+		}
+		if tc.Encap.RemoteCsum {
+			ta.encapFlags |= uint16(netlink.RemCSum)
+		}
+	}
+	return ta, nil
+}
+
+// LANewGRE creates a new L3 GRE tunnel with the given name and configuration.
+// This is a gre link if the tunnel addresses are IPv4, or an ip6gre link if
+// they are IPv6.
+func LANewGRE(name string, config GREConfig) LinkAction {
+	return LinkAction{
+		actionName: "new-gre",
+		desc:       NewDescriptor("LANewGRE", name, config),
+		f: func() error {
+			ta, err := config.attrs(nil)
+			if err != nil {
+				return err
+			}
+			gre := netlink.Gretun{
+				LinkAttrs:  netlink.NewLinkAttrs(),
+				Link:       ta.link,
+				IKey:       config.IKey,
+				OKey:       config.OKey,
+				Local:      ta.local,
+				Remote:     ta.remote,
+				Ttl:        config.TTL,
+				Tos:        config.TOS,
+				PMtuDisc:   ta.pmtudisc,
+				EncapType:  ta.encapType,
+				EncapFlags: ta.encapFlags,
+				EncapSport: ta.encapSport,
+				EncapDport: ta.encapDport,
+			}
+			gre.LinkAttrs.Name = name
+			return backend.LinkAdd(&gre)
+		},
+	}
+}
+
+// LANewIPIP creates a new IPv4 in IPv4 (ipip) tunnel with the given name and
+// configuration.
+func LANewIPIP(name string, config TunnelConfig) LinkAction {
+	return LinkAction{
+		actionName: "new-ipip",
+		desc:       NewDescriptor("LANewIPIP", name, config),
+		f: func() error {
+			v4 := true
+			ta, err := config.attrs(&v4)
+			if err != nil {
+				return err
+			}
+			ipip := netlink.Iptun{
+				LinkAttrs:  netlink.NewLinkAttrs(),
+				Link:       ta.link,
+				Local:      ta.local,
+				Remote:     ta.remote,
+				Ttl:        config.TTL,
+				Tos:        config.TOS,
+				PMtuDisc:   ta.pmtudisc,
+				EncapType:  ta.encapType,
+				EncapFlags: ta.encapFlags,
+				EncapSport: ta.encapSport,
+				EncapDport: ta.encapDport,
+			}
+			ipip.LinkAttrs.Name = name
+			return backend.LinkAdd(&ipip)
+		},
+	}
+}
+
+// LANewSIT creates a new IPv6 in IPv4 (sit) tunnel with the given name and
+// configuration.
+func LANewSIT(name string, config TunnelConfig) LinkAction {
+	return LinkAction{
+		actionName: "new-sit",
+		desc:       NewDescriptor("LANewSIT", name, config),
+		f: func() error {
+			v4 := true
+			ta, err := config.attrs(&v4)
+			if err != nil {
+				return err
+			}
+			sit := netlink.Sittun{
+				LinkAttrs:  netlink.NewLinkAttrs(),
+				Link:       ta.link,
+				Local:      ta.local,
+				Remote:     ta.remote,
+				Ttl:        config.TTL,
+				Tos:        config.TOS,
+				PMtuDisc:   ta.pmtudisc,
+				EncapType:  ta.encapType,
+				EncapFlags: ta.encapFlags,
+				EncapSport: ta.encapSport,
+				EncapDport: ta.encapDport,
+			}
+			sit.LinkAttrs.Name = name
+			return backend.LinkAdd(&sit)
+		},
+	}
+}
+
+// LANewIP6Tnl creates a new IPv4 or IPv6 in IPv6 (ip6tnl) tunnel with the given
+// name and configuration. Path MTU discovery is not configurable for this
+// tunnel type.
+func LANewIP6Tnl(name string, config TunnelConfig) LinkAction {
+	return LinkAction{
+		actionName: "new-ip6tnl",
+		desc:       NewDescriptor("LANewIP6Tnl", name, config),
+		f: func() error {
+			v4 := false
+			ta, err := config.attrs(&v4)
+			if err != nil {
+				return err
+			}
+			tnl := netlink.Ip6tnl{
+				LinkAttrs:  netlink.NewLinkAttrs(),
+				Link:       ta.link,
+				Local:      ta.local,
+				Remote:     ta.remote,
+				Ttl:        config.TTL,
+				Tos:        config.TOS,
+				EncapType:  ta.encapType,
+				EncapFlags: ta.encapFlags,
+				EncapSport: ta.encapSport,
+				EncapDport: ta.encapDport,
+			}
+			tnl.LinkAttrs.Name = name
+			return backend.LinkAdd(&tnl)
+		},
+	}
+}
+
+// LANewGeneve creates a new Geneve tunnel with the given name and
+// configuration.
+func LANewGeneve(name string, config GeneveConfig) LinkAction {
+	return LinkAction{
+		actionName: "new-geneve",
+		desc:       NewDescriptor("LANewGeneve", name, config),
+		f: func() error {
+			if config.Local != nil || config.Underlay != nil || config.Encap != nil {
+				return fmt.Errorf("geneve tunnels do not support a local address, underlay link or encapsulation")
+			}
+			ta, err := config.attrs(nil)
+			if err != nil {
+				return err
+			}
+			port := config.Port
+			if port == 0 {
+				port = 6081
+			}
+			df := netlink.GENEVE_DF_UNSET
+			if ta.pmtudisc == 1 {
+				df = netlink.GENEVE_DF_SET
+			}
+			geneve := netlink.Geneve{
+				LinkAttrs: netlink.NewLinkAttrs(),
+				ID:        config.VNI,
+				Remote:    ta.remote,
+				Ttl:       config.TTL,
+				Tos:       config.TOS,
+				Dport:     port,
+				Df:        df,
+			}
+			geneve.LinkAttrs.Name = name
+			return backend.LinkAdd(&geneve)
 		},
 	}
 }
@@ -167,45 +662,55 @@ func LANewVxlan(name, localIP, groupIP string, id, port int) LinkAction {
 func LADelete(provider LinkProvider) LinkAction {
 	return LinkAction{
 		actionName: "delete-link",
+		desc:       NewDescriptor("LADelete", provider),
 		f: func() error {
 			if l, err := provider.Provide(); err != nil {
 				return errors.Join(errNoLink, err)
 			} else {
-				return netlink.LinkDel(l)
+				return backend.LinkDel(l)
 			}
 		},
 	}
 }
 
+// LASetName renames the link to the given name. The link must be down for
+// the kernel to allow it to be renamed.
 func LASetName(provider LinkProvider, name string) LinkAction {
 	return LinkAction{
 		actionName: "set-name",
+		desc:       NewDescriptor("LASetName", provider, name),
 		f: func() error {
 			if l, err := provider.Provide(); err != nil {
 				return errors.Join(errNoLink, err)
 			} else {
-				return netlink.LinkSetName(l, name)
+				return backend.LinkSetName(l, name)
 			}
 		},
 	}
 }
 
+// LASetAlias sets the alias of the link, a free-form description that can be
+// used to find it again via LPAlias.
 func LASetAlias(provider LinkProvider, alias string) LinkAction {
 	return LinkAction{
 		actionName: "set-alias",
+		desc:       NewDescriptor("LASetAlias", provider, alias),
 		f: func() error {
 			if l, err := provider.Provide(); err != nil {
 				return errors.Join(errNoLink, err)
 			} else {
-				return netlink.LinkSetAlias(l, alias)
+				return backend.LinkSetAlias(l, alias)
 			}
 		},
 	}
 }
 
+// LASetHw sets the hardware (MAC) address of the link to the given address,
+// such as 02:00:00:00:00:01.
 func LASetHw(provider LinkProvider, addr string) LinkAction {
 	return LinkAction{
 		actionName: "set-hw",
+		desc:       NewDescriptor("LASetHw", provider, addr),
 		f: func() error {
 			if l, err := provider.Provide(); err != nil {
 				return errors.Join(errNoLink, err)
@@ -214,67 +719,193 @@ func LASetHw(provider LinkProvider, addr string) LinkAction {
 				if err != nil {
 					return err
 				}
-				return netlink.LinkSetHardwareAddr(l, hwAddr)
+				return backend.LinkSetHardwareAddr(l, hwAddr)
 			}
 		},
 	}
 }
 
+// LASetMTU sets the MTU of the link.
+func LASetMTU(provider LinkProvider, mtu int) LinkAction {
+	return LinkAction{
+		actionName: "set-mtu",
+		desc:       NewDescriptor("LASetMTU", provider, mtu),
+		f: func() error {
+			if l, err := provider.Provide(); err != nil {
+				return errors.Join(errNoLink, err)
+			} else {
+				return backend.LinkSetMTU(l, mtu)
+			}
+		},
+	}
+}
+
+// LinkSettings is a partial set of link attributes for use with LASet. Only
+// the fields that are set (non-nil or non-empty) are applied to the link. Ptr
+// can be used to set the optional fields inline.
+type LinkSettings struct {
+	MTU          *int
+	TxQLen       *int
+	Group        *int
+	GSOMaxSize   *int
+	GSOMaxSegs   *int
+	GROMaxSize   *int
+	Multicast    *bool
+	AllMulticast *bool
+	ARP          *bool
+	AddAltNames  []string
+	DelAltNames  []string
+}
+
+// Ptr returns a pointer to the given value, for use with optional fields such
+// as those of LinkSettings.
+func Ptr[T any](v T) *T {
+	return &v
+}
+
+// LASet applies the given settings to the link. Settings are applied in the
+// order of the LinkSettings fields, stopping at the first that fails.
+func LASet(provider LinkProvider, settings LinkSettings) LinkAction {
+	return LinkAction{
+		actionName: "set",
+		desc:       NewDescriptor("LASet", provider, settings),
+		f: func() error {
+			l, err := provider.Provide()
+			if err != nil {
+				return errors.Join(errNoLink, err)
+			}
+			type setting struct {
+				name  string
+				apply func() error
+			}
+			set := make([]setting, 0)
+			if settings.MTU != nil {
+				set = append(set, setting{"mtu", func() error { return backend.LinkSetMTU(l, *settings.MTU) }})
+			}
+			if settings.TxQLen != nil {
+				set = append(set, setting{"txqueuelen", func() error { return backend.LinkSetTxQLen(l, *settings.TxQLen) }})
+			}
+			if settings.Group != nil {
+				set = append(set, setting{"group", func() error { return backend.LinkSetGroup(l, *settings.Group) }})
+			}
+			if settings.GSOMaxSize != nil {
+				set = append(set, setting{"gso max size", func() error { return backend.LinkSetGSOMaxSize(l, *settings.GSOMaxSize) }})
+			}
+			if settings.GSOMaxSegs != nil {
+				set = append(set, setting{"gso max segs", func() error { return backend.LinkSetGSOMaxSegs(l, *settings.GSOMaxSegs) }})
+			}
+			if settings.GROMaxSize != nil {
+				set = append(set, setting{"gro max size", func() error { return backend.LinkSetGROMaxSize(l, *settings.GROMaxSize) }})
+			}
+			if settings.Multicast != nil {
+				set = append(set, setting{"multicast", func() error {
+					if *settings.Multicast {
+						return backend.LinkSetMulticastOn(l)
+					}
+					return backend.LinkSetMulticastOff(l)
+				}})
+			}
+			if settings.AllMulticast != nil {
+				set = append(set, setting{"allmulticast", func() error {
+					if *settings.AllMulticast {
+						return backend.LinkSetAllmulticastOn(l)
+					}
+					return backend.LinkSetAllmulticastOff(l)
+				}})
+			}
+			if settings.ARP != nil {
+				set = append(set, setting{"arp", func() error {
+					if *settings.ARP {
+						return backend.LinkSetARPOn(l)
+					}
+					return backend.LinkSetARPOff(l)
+				}})
+			}
+			for _, altName := range settings.AddAltNames {
+				altName := altName
+				set = append(set, setting{"add altname " + altName, func() error { return backend.LinkAddAltName(l, altName) }})
+			}
+			for _, altName := range settings.DelAltNames {
+				altName := altName
+				set = append(set, setting{"del altname " + altName, func() error { return backend.LinkDelAltName(l, altName) }})
+			}
+			for _, s := range set {
+				if err := s.apply(); err != nil {
+					return fmt.Errorf("failed to set %s of link %s: %w", s.name, l.Attrs().Name, err)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// LASetUp sets the administrative state of the link to up.
 func LASetUp(provider LinkProvider) LinkAction {
 	return LinkAction{
 		actionName: "set-state-up",
+		desc:       NewDescriptor("LASetUp", provider),
 		f: func() error {
 			if l, err := provider.Provide(); err != nil {
 				return errors.Join(errNoLink, err)
 			} else {
-				return netlink.LinkSetUp(l)
+				return backend.LinkSetUp(l)
 			}
 		},
 	}
 }
 
+// LASetDown sets the administrative state of the link to down.
 func LASetDown(provider LinkProvider) LinkAction {
 	return LinkAction{
 		actionName: "set-state-down",
+		desc:       NewDescriptor("LASetDown", provider),
 		f: func() error {
 			if l, err := provider.Provide(); err != nil {
 				return errors.Join(errNoLink, err)
 			} else {
-				return netlink.LinkSetDown(l)
+				return backend.LinkSetDown(l)
 			}
 		},
 	}
 }
 
+// LASetPromiscOn enables promiscuous mode on the link, so that it receives
+// all packets regardless of their destination hardware address.
 func LASetPromiscOn(provider LinkProvider) LinkAction {
 	return LinkAction{
 		actionName: "set-promisc-on",
+		desc:       NewDescriptor("LASetPromiscOn", provider),
 		f: func() error {
 			if l, err := provider.Provide(); err != nil {
 				return errors.Join(errNoLink, err)
 			} else {
-				return netlink.SetPromiscOn(l)
+				return backend.SetPromiscOn(l)
 			}
 		},
 	}
 }
 
+// LASetPromiscOff disables promiscuous mode on the link.
 func LASetPromiscOff(provider LinkProvider) LinkAction {
 	return LinkAction{
 		actionName: "set-promisc-off",
+		desc:       NewDescriptor("LASetPromiscOff", provider),
 		f: func() error {
 			if l, err := provider.Provide(); err != nil {
 				return errors.Join(errNoLink, err)
 			} else {
-				return netlink.SetPromiscOff(l)
+				return backend.SetPromiscOff(l)
 			}
 		},
 	}
 }
 
+// LAAddAddr adds the given address (in CIDR notation, such as 10.0.0.1/24) to
+// the link. To set further attributes of the address, see LAAddAddrConfig.
 func LAAddAddr(provider LinkProvider, cidr string) LinkAction {
 	return LinkAction{
 		actionName: "add-address",
+		desc:       NewDescriptor("LAAddAddr", provider, cidr),
 		f: func() error {
 			if l, err := provider.Provide(); err != nil {
 				return errors.Join(errNoLink, err)
@@ -283,15 +914,17 @@ func LAAddAddr(provider LinkProvider, cidr string) LinkAction {
 				if err != nil {
 					return fmt.Errorf("failed to parse cidr to network address: %w", err)
 				}
-				return netlink.AddrAdd(l, addr)
+				return backend.AddrAdd(l, addr)
 			}
 		},
 	}
 }
 
+// LADelAddr removes the given address (in CIDR notation) from the link.
 func LADelAddr(provider LinkProvider, cidr string) LinkAction {
 	return LinkAction{
 		actionName: "del-address",
+		desc:       NewDescriptor("LADelAddr", provider, cidr),
 		f: func() error {
 			if l, err := provider.Provide(); err != nil {
 				return errors.Join(errNoLink, err)
@@ -300,8 +933,652 @@ func LADelAddr(provider LinkProvider, cidr string) LinkAction {
 				if err != nil {
 					return fmt.Errorf("failed to parse cidr to network address: %w", err)
 				}
-				return netlink.AddrDel(l, addr)
+				return backend.AddrDel(l, addr)
 			}
 		},
 	}
 }
+
+// LASetMaster attaches the link to the given master link, such as a bridge.
+func LASetMaster(provider LinkProvider, master LinkProvider) LinkAction {
+	return LinkAction{
+		actionName: "set-master",
+		desc:       NewDescriptor("LASetMaster", provider, master),
+		f: func() error {
+			if l, err := provider.Provide(); err != nil {
+				return errors.Join(errNoLink, err)
+			} else {
+				m, err := master.Provide()
+				if err != nil {
+					return fmt.Errorf("failed to get master link from provider: %w", err)
+				}
+				return backend.LinkSetMaster(l, m)
+			}
+		},
+	}
+}
+
+// LASetNoMaster detaches the link from its master link, if it has one.
+func LASetNoMaster(provider LinkProvider) LinkAction {
+	return LinkAction{
+		actionName: "set-no-master",
+		desc:       NewDescriptor("LASetNoMaster", provider),
+		f: func() error {
+			if l, err := provider.Provide(); err != nil {
+				return errors.Join(errNoLink, err)
+			} else {
+				return backend.LinkSetNoMaster(l)
+			}
+		},
+	}
+}
+
+// LAAddRoute adds a route to the given destination (in CIDR notation) via the
+// link. If the destination is empty, a default route is added (of the family of
+// the gateway, or IPv4 if there is no gateway). The gateway may be empty for
+// routes that are directly reachable via the link.
+func LAAddRoute(provider LinkProvider, dst, gateway string) LinkAction {
+	return LinkAction{
+		actionName: "add-route",
+		desc:       NewDescriptor("LAAddRoute", provider, dst, gateway),
+		f: func() error {
+			if l, err := provider.Provide(); err != nil {
+				return errors.Join(errNoLink, err)
+			} else {
+				route, err := parseRoute(l, dst, gateway)
+				if err != nil {
+					return err
+				}
+				return backend.RouteAdd(route)
+			}
+		},
+	}
+}
+
+// LADelRoute deletes the route to the given destination (in CIDR notation) via
+// the link. As with LAAddRoute, if the destination is empty, the default route
+// (of the family of the gateway, or IPv4 if there is no gateway) is deleted.
+func LADelRoute(provider LinkProvider, dst, gateway string) LinkAction {
+	return LinkAction{
+		actionName: "del-route",
+		desc:       NewDescriptor("LADelRoute", provider, dst, gateway),
+		f: func() error {
+			if l, err := provider.Provide(); err != nil {
+				return errors.Join(errNoLink, err)
+			} else {
+				route, err := parseRoute(l, dst, gateway)
+				if err != nil {
+					return err
+				}
+				return backend.RouteDel(route)
+			}
+		},
+	}
+}
+
+// parseRoute creates a route via the given link from a destination cidr and
+// gateway ip, either of which may be empty. An empty destination is the default
+// route of the family of the gateway, or of IPv4 if the gateway is also empty.
+func parseRoute(l netlink.Link, dst, gateway string) (*netlink.Route, error) {
+	route := netlink.Route{
+		LinkIndex: l.Attrs().Index,
+	}
+	if gateway != "" {
+		route.Gw = net.ParseIP(gateway)
+		if route.Gw == nil {
+			return nil, fmt.Errorf("failed to parse the route gateway")
+		}
+	}
+	if dst == "" {
+		route.Dst = &net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 8*net.IPv4len)}
+		if route.Gw != nil && route.Gw.To4() == nil {
+			route.Dst = &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 8*net.IPv6len)}
+		}
+		return &route, nil
+	}
+	_, dstNet, err := net.ParseCIDR(dst)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the route destination: %w", err)
+	}
+	route.Dst = dstNet
+	return &route, nil
+}
+
+// AddrConfig describes a network address and its attributes. The address
+// itself is given in CIDR notation. Peer (in CIDR notation) sets the remote
+// address of point-to-point links, and Broadcast sets the broadcast address of
+// IPv4 addresses. A scope of nil uses the kernel's default for the address.
+// Lifetimes of 0 are treated as forever. For IPv6 addresses, NoDAD skips
+// duplicate address detection, NoPrefixRoute stops the prefix route being
+// added, and MngTmpAddr has temporary addresses created from this one. If
+// WaitDAD is greater than 0, adding the address blocks for up to that long
+// until duplicate address detection completes.
+type AddrConfig struct {
+	CIDR          string
+	Peer          string
+	Broadcast     string
+	Label         string
+	Scope         *netlink.Scope
+	ValidLft      time.Duration
+	PreferredLft  time.Duration
+	NoDAD         bool
+	NoPrefixRoute bool
+	MngTmpAddr    bool
+	WaitDAD       time.Duration
+}
+
+// addr converts the config into a netlink address.
+func (ac AddrConfig) addr() (*netlink.Addr, error) {
+	addr, err := netlink.ParseAddr(ac.CIDR)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse cidr to network address: %w", err)
+	}
+	if ac.Peer != "" {
+		peer, err := netlink.ParseIPNet(ac.Peer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the peer address: %w", err)
+		}
+		addr.Peer = peer
+	}
+	if ac.Broadcast != "" {
+		if addr.Broadcast = net.ParseIP(ac.Broadcast); addr.Broadcast == nil {
+			return nil, fmt.Errorf("failed to parse the broadcast address")
+		}
+	}
+	addr.Label = ac.Label
+	if ac.Scope != nil {
+		addr.Scope = int(*ac.Scope)
+	}
+	if ac.ValidLft > 0 || ac.PreferredLft > 0 {
+		// the preferred lifetime may not exceed the valid lifetime
+		addr.ValidLft = lifetime(ac.ValidLft)
+		addr.PreferedLft = min(lifetime(ac.PreferredLft), addr.ValidLft)
+	}
+	if ac.NoDAD {
+		addr.Flags |= unix.IFA_F_NODAD
+	}
+	if ac.NoPrefixRoute {
+		addr.Flags |= unix.IFA_F_NOPREFIXROUTE
+	}
+	if ac.MngTmpAddr {
+		addr.Flags |= unix.IFA_F_MANAGETEMPADDR
+	}
+	return addr, nil
+}
+
+// lifetime converts a duration to an address lifetime in seconds, where 0 is
+// treated as forever.
+func lifetime(d time.Duration) int {
+	if d <= 0 || d.Seconds() >= math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return int(d.Seconds())
+}
+
+// LAAddAddrConfig adds the address described by the given config to the link.
+// If the config has WaitDAD set, the action blocks until duplicate address
+// detection completes, erroring if it fails or does not complete in time.
+func LAAddAddrConfig(provider LinkProvider, config AddrConfig) LinkAction {
+	return LinkAction{
+		actionName: "add-address-config",
+		desc:       NewDescriptor("LAAddAddrConfig", provider, config),
+		f: func() error {
+			return addAddr(provider, config, backend.AddrAdd)
+		},
+	}
+}
+
+// LAReplaceAddr adds the address described by the given config to the link,
+// or replaces the attributes of the address if it is already present.
+func LAReplaceAddr(provider LinkProvider, config AddrConfig) LinkAction {
+	return LinkAction{
+		actionName: "replace-address",
+		desc:       NewDescriptor("LAReplaceAddr", provider, config),
+		f: func() error {
+			return addAddr(provider, config, backend.AddrReplace)
+		},
+	}
+}
+
+// LAFlushAddrs removes every address of the given family (such as
+// netlink.FAMILY_V4, or netlink.FAMILY_ALL) from the link.
+func LAFlushAddrs(provider LinkProvider, family int) LinkAction {
+	return LinkAction{
+		actionName: "flush-addresses",
+		desc:       NewDescriptor("LAFlushAddrs", provider, family),
+		f: func() error {
+			if l, err := provider.Provide(); err != nil {
+				return errors.Join(errNoLink, err)
+			} else {
+				addrs, err := backend.AddrList(l, family)
+				if err != nil {
+					return fmt.Errorf("failed to list addresses: %w", err)
+				}
+				for _, addr := range addrs {
+					addr := addr
+					if err := backend.AddrDel(l, &addr); err != nil && !errors.Is(err, unix.EADDRNOTAVAIL) {
+						return fmt.Errorf("failed to delete address %s: %w", addr.IPNet, err)
+					}
+				}
+				return nil
+			}
+		},
+	}
+}
+
+// LAGetAddrs gets the addresses of the given family (such as
+// netlink.FAMILY_V4, or netlink.FAMILY_ALL) on the link, storing them in the
+// given addrs parameter.
+func LAGetAddrs(provider LinkProvider, family int, addrs *[]netlink.Addr) LinkAction {
+	return LinkAction{
+		actionName: "get-addresses",
+		desc:       NewDescriptor("LAGetAddrs", provider, family),
+		f: func() error {
+			if l, err := provider.Provide(); err != nil {
+				return errors.Join(errNoLink, err)
+			} else {
+				a, err := backend.AddrList(l, family)
+				if err != nil {
+					return err
+				}
+				*addrs = a
+				return nil
+			}
+		},
+	}
+}
+
+// addAddr adds the address described by the config to the provided link via
+// the given netlink function, waiting for DAD if required.
+func addAddr(provider LinkProvider, config AddrConfig, add func(netlink.Link, *netlink.Addr) error) error {
+	l, err := provider.Provide()
+	if err != nil {
+		return errors.Join(errNoLink, err)
+	}
+	addr, err := config.addr()
+	if err != nil {
+		return err
+	}
+	if err := add(l, addr); err != nil {
+		return err
+	}
+	if config.WaitDAD <= 0 || config.NoDAD || addr.IP.To4() != nil {
+		return nil
+	}
+	return waitAddr(provider, addr.IP, config.WaitDAD)
+}
+
+// LAWaitExists waits for up to the given timeout for the provider to provide a
+// link, such as one that is being created asynchronously. A timeout of 0 waits
+// indefinitely.
+func LAWaitExists(provider LinkProvider, timeout time.Duration) LinkAction {
+	return LinkAction{
+		actionName: "wait-exists",
+		desc:       NewDescriptor("LAWaitExists", provider, timeout),
+		f: func() error {
+			return waitLink(provider, timeout, "exist", func(l netlink.Link) bool {
+				return true
+			})
+		},
+	}
+}
+
+// LAWaitOperUp waits for up to the given timeout for the operational state of
+// the link to be up. A timeout of 0 waits indefinitely.
+func LAWaitOperUp(provider LinkProvider, timeout time.Duration) LinkAction {
+	return LinkAction{
+		actionName: "wait-oper-up",
+		desc:       NewDescriptor("LAWaitOperUp", provider, timeout),
+		f: func() error {
+			return waitLink(provider, timeout, "be operationally up", func(l netlink.Link) bool {
+				return l.Attrs().OperState == netlink.OperUp
+			})
+		},
+	}
+}
+
+// LAWaitCarrier waits for up to the given timeout for the link to have a
+// carrier. A timeout of 0 waits indefinitely.
+func LAWaitCarrier(provider LinkProvider, timeout time.Duration) LinkAction {
+	return LinkAction{
+		actionName: "wait-carrier",
+		desc:       NewDescriptor("LAWaitCarrier", provider, timeout),
+		f: func() error {
+			return waitLink(provider, timeout, "have a carrier", func(l netlink.Link) bool {
+				return l.Attrs().RawFlags&unix.IFF_LOWER_UP != 0
+			})
+		},
+	}
+}
+
+// LAWaitAddr waits for up to the given timeout for the link to have the given
+// address (in CIDR notation, or a plain IP) in a usable state, meaning IPv6
+// addresses must have completed duplicate address detection. An error is
+// returned straight away if duplicate address detection fails. A timeout of 0
+// waits indefinitely.
+func LAWaitAddr(provider LinkProvider, addr string, timeout time.Duration) LinkAction {
+	return LinkAction{
+		actionName: "wait-address",
+		desc:       NewDescriptor("LAWaitAddr", provider, addr, timeout),
+		f: func() error {
+			ip := net.ParseIP(addr)
+			if ip == nil {
+				var err error
+				if ip, _, err = net.ParseCIDR(addr); err != nil {
+					return fmt.Errorf("failed to parse address: %w", err)
+				}
+			}
+			return waitAddr(provider, ip, timeout)
+		},
+	}
+}
+
+// waitLink waits until the link given by the provider satisfies the given
+// condition, re-checking the link each time a link update is received.
+func waitLink(provider LinkProvider, timeout time.Duration, condition string, ready func(netlink.Link) bool) error {
+	return waitUntil(timeout, "link to "+condition,
+		backend.LinkSubscribe,
+		func() (bool, error) {
+			l, err := provider.Provide()
+			if err != nil {
+				return false, nil
+			}
+			return ready(l), nil
+		},
+	)
+}
+
+// waitAddr waits until the link given by the provider has the given address,
+// and the address is no longer tentative.
+func waitAddr(provider LinkProvider, ip net.IP, timeout time.Duration) error {
+	return waitUntil(timeout, fmt.Sprintf("address %s to be usable", ip),
+		backend.AddrSubscribe,
+		func() (bool, error) {
+			l, err := provider.Provide()
+			if err != nil {
+				return false, nil
+			}
+			addrs, err := backend.AddrList(l, netlink.FAMILY_ALL)
+			if err != nil {
+				return false, fmt.Errorf("failed to list addresses: %w", err)
+			}
+			for _, a := range addrs {
+				if !a.IP.Equal(ip) {
+					continue
+				}
+				if a.Flags&unix.IFA_F_DADFAILED != 0 {
+					return false, fmt.Errorf("%w: %s", errDADFailed, ip)
+				}
+				return a.Flags&unix.IFA_F_TENTATIVE == 0, nil
+			}
+			return false, nil
+		},
+	)
+}
+
+// waitUntil subscribes to netlink updates in the current netns, then waits
+// until the given check passes. The check is performed once the subscription
+// is in place, and again after every update, so no change can be missed. An
+// error from the check ends the wait straight away. A timeout of 0 waits
+// indefinitely.
+func waitUntil[T any](timeout time.Duration, description string, subscribe func(chan T, chan struct{}, func(error)) error, check func() (bool, error)) error {
+	updates := make(chan T)
+	done := make(chan struct{})
+	subErr := make(chan error, 1)
+	if err := subscribe(updates, done, func(err error) {
+		select {
+		case subErr <- err:
+		default:
+		}
+	}); err != nil {
+		return fmt.Errorf("failed to subscribe to netlink updates: %w", err)
+	}
+	defer func() {
+		// the subscription only stops once any pending update is received
+		close(done)
+		go func() {
+			for range updates {
+			}
+		}()
+	}()
+
+	var timeoutC <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutC = timer.C
+	}
+	for {
+		if ok, err := check(); err != nil || ok {
+			return err
+		}
+		select {
+		case _, ok := <-updates:
+			if !ok {
+				select {
+				case err := <-subErr:
+					return fmt.Errorf("netlink subscription failed whilst waiting for %s: %w", description, err)
+				default:
+					return fmt.Errorf("netlink subscription closed whilst waiting for %s", description)
+				}
+			}
+		case <-timeoutC:
+			return fmt.Errorf("timed out after %s waiting for %s", timeout, description)
+		}
+	}
+}
+
+// LAEnsureBridge creates a new bridge with the given name, unless a bridge with
+// the name already exists. If a link of another type has the name, an error
+// wrapping ErrConflict is returned.
+func LAEnsureBridge(name string) LinkAction {
+	return LinkAction{
+		actionName: "ensure-bridge",
+		desc:       NewDescriptor("LAEnsureBridge", name),
+		f: func() error {
+			_, err := ensureLink(name, "bridge", LANewBridge(name))
+			return err
+		},
+	}
+}
+
+// LAEnsureDummy creates a new dummy link with the given name, unless a dummy
+// link with the name already exists. If a link of another type has the name,
+// an error wrapping ErrConflict is returned.
+func LAEnsureDummy(name string) LinkAction {
+	return LinkAction{
+		actionName: "ensure-dummy",
+		desc:       NewDescriptor("LAEnsureDummy", name),
+		f: func() error {
+			_, err := ensureLink(name, "dummy", LANewDummy(name))
+			return err
+		},
+	}
+}
+
+// LAEnsureVeth creates a new veth pair with the given names, unless a veth with
+// the name already exists. If a link of another type has the name, or the
+// existing veth has a peer in this netns with a different name, an error
+// wrapping ErrConflict is returned. A peer that has since been moved to another
+// netns is accepted as is.
+func LAEnsureVeth(name, peerName string) LinkAction {
+	return LinkAction{
+		actionName: "ensure-veth",
+		desc:       NewDescriptor("LAEnsureVeth", name, peerName),
+		f: func() error {
+			l, err := ensureLink(name, "veth", LANewVeth(name, peerName))
+			if err != nil || l == nil {
+				return err
+			}
+			peerIdx, peerNsID, err := vethPeer(l)
+			if err != nil {
+				return fmt.Errorf("failed to check the peer of veth %s: %w", name, err)
+			}
+			if peerNsID >= 0 {
+				return nil
+			}
+			peer, err := backend.LinkByIndex(peerIdx)
+			if err != nil {
+				return fmt.Errorf("failed to get the peer of veth %s: %w", name, err)
+			}
+			if peer.Attrs().Name != peerName {
+				return fmt.Errorf("%w: veth %s has peer %s, not %s", ErrConflict, name, peer.Attrs().Name, peerName)
+			}
+			return nil
+		},
+	}
+}
+
+// LAEnsureAddr adds the given address (in CIDR notation) to the link, unless
+// the link already has it. If the link has the address with a different prefix
+// length, an error wrapping ErrConflict is returned.
+func LAEnsureAddr(provider LinkProvider, cidr string) LinkAction {
+	return LinkAction{
+		actionName: "ensure-address",
+		desc:       NewDescriptor("LAEnsureAddr", provider, cidr),
+		f: func() error {
+			return ensureAddr(provider, AddrConfig{CIDR: cidr})
+		},
+	}
+}
+
+// LAEnsureAddrConfig adds the address described by the given config to the
+// link, unless the link already has it. If the link has the address with a
+// different prefix length, or without the scope or flags (NoDAD, NoPrefixRoute
+// and MngTmpAddr) requested by the config, an error wrapping ErrConflict is
+// returned. Attributes the config leaves unset are not checked.
+func LAEnsureAddrConfig(provider LinkProvider, config AddrConfig) LinkAction {
+	return LinkAction{
+		actionName: "ensure-address-config",
+		desc:       NewDescriptor("LAEnsureAddrConfig", provider, config),
+		f: func() error {
+			return ensureAddr(provider, config)
+		},
+	}
+}
+
+// ensureAddr adds the address described by the config to the provided link,
+// unless the link already has it with matching attributes.
+func ensureAddr(provider LinkProvider, config AddrConfig) error {
+	l, err := provider.Provide()
+	if err != nil {
+		return errors.Join(errNoLink, err)
+	}
+	addr, err := config.addr()
+	if err != nil {
+		return err
+	}
+	addrs, err := backend.AddrList(l, netlink.FAMILY_ALL)
+	if err != nil {
+		return fmt.Errorf("failed to list addresses: %w", err)
+	}
+	for _, a := range addrs {
+		if !a.IP.Equal(addr.IP) {
+			continue
+		}
+		if ones, _ := a.Mask.Size(); ones != prefixLen(addr.IPNet) {
+			return fmt.Errorf("%w: link %s has address %s, not %s", ErrConflict, l.Attrs().Name, a.IPNet, addr.IPNet)
+		}
+		if config.Scope != nil && a.Scope != addr.Scope {
+			return fmt.Errorf("%w: address %s on link %s has scope %s, not %s", ErrConflict, a.IPNet, l.Attrs().Name, netlink.Scope(a.Scope), netlink.Scope(addr.Scope))
+		}
+		if a.Flags&addr.Flags != addr.Flags {
+			return fmt.Errorf("%w: address %s on link %s has flags %#x, missing %#x", ErrConflict, a.IPNet, l.Attrs().Name, a.Flags, addr.Flags&^a.Flags)
+		}
+		return nil
+	}
+	return addAddr(provider, config, backend.AddrAdd)
+}
+
+// prefixLen gets the prefix length of the given network.
+func prefixLen(n *net.IPNet) int {
+	ones, _ := n.Mask.Size()
+	return ones
+}
+
+// LAEnsureRoute adds a route via the link to the given destination, unless the
+// route is already present. Like LAAddRoute, an empty destination is the
+// default route and the gateway is optional. If a route to the destination
+// already exists in the main table, but none has the same link, gateway and
+// priority, an error wrapping ErrConflict is returned.
+func LAEnsureRoute(provider LinkProvider, dst, gateway string) LinkAction {
+	return LinkAction{
+		actionName: "ensure-route",
+		desc:       NewDescriptor("LAEnsureRoute", provider, dst, gateway),
+		f: func() error {
+			if l, err := provider.Provide(); err != nil {
+				return errors.Join(errNoLink, err)
+			} else {
+				route, err := parseRoute(l, dst, gateway)
+				if err != nil {
+					return err
+				}
+				family := netlink.FAMILY_V6
+				if route.Dst.IP.To4() != nil {
+					family = netlink.FAMILY_V4
+				}
+				routes, err := backend.RouteList(nil, family)
+				if err != nil {
+					return fmt.Errorf("failed to list routes: %w", err)
+				}
+				var conflict *netlink.Route
+				for _, r := range routes {
+					r := r
+					if !routeDstEqual(r.Dst, route.Dst) {
+						continue
+					}
+					if routeEqual(r, *route, family) {
+						return nil
+					}
+					conflict = &r
+				}
+				if conflict != nil {
+					return fmt.Errorf("%w: route to %s is via link index %d and gateway %s in table %d with priority %d", ErrConflict, route.Dst, conflict.LinkIndex, conflict.Gw, conflict.Table, conflict.Priority)
+				}
+				return backend.RouteAdd(route)
+			}
+		},
+	}
+}
+
+// routeEqual checks if the two routes to the same destination have the same
+// link, gateway, table and priority. An unset table is the main table, and an
+// unset priority of an IPv6 route is the kernel's default metric.
+func routeEqual(a, b netlink.Route, family int) bool {
+	table := func(r netlink.Route) int {
+		if r.Table == 0 {
+			return unix.RT_TABLE_MAIN
+		}
+		return r.Table
+	}
+	priority := func(r netlink.Route) int {
+		if r.Priority == 0 && family == netlink.FAMILY_V6 {
+			return ip6DefaultMetric
+		}
+		return r.Priority
+	}
+	return a.LinkIndex == b.LinkIndex && a.Gw.Equal(b.Gw) && table(a) == table(b) && priority(a) == priority(b)
+}
+
+// ensureLink gets the link with the given name, checking that it is of the
+// given type, or performs the given action to create it. If the link is
+// created, nil is returned in place of the link.
+func ensureLink(name, linkType string, create LinkAction) (netlink.Link, error) {
+	l, err := backend.LinkByName(name)
+	if err != nil {
+		if !errors.Is(err, ErrLinkNotFound) {
+			return nil, fmt.Errorf("failed to check for existing link %s: %w", name, err)
+		}
+		if err := create.act(); err != nil {
+			if errors.Is(err, unix.EEXIST) {
+				return nil, fmt.Errorf("%w: link with a name of %s (or its peer) already exists", ErrConflict, name)
+			}
+			return nil, err
+		}
+		return nil, nil
+	}
+	if l.Type() != linkType {
+		return nil, fmt.Errorf("%w: link %s is a %s, not a %s", ErrConflict, name, l.Type(), linkType)
+	}
+	return l, nil
+}
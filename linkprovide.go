@@ -1,18 +1,40 @@
 package neslink
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"net"
 
 	"github.com/vishvananda/netlink"
 )
 
+// LinkProvider offers an approach to obtaining a single link based on given
+// conditions.
 type LinkProvider struct {
 	name string
 	f    func() (netlink.Link, error)
+	desc Descriptor
+}
+
+// LinksProvider offers an approach to obtaining every link that matches given
+// conditions. These can be used with LAForEach to apply an action to a set of
+// links.
+type LinksProvider struct {
+	name string
+	f    func() ([]netlink.Link, error)
+	desc Descriptor
 }
 
 var (
-	errNoLink error = errors.New("failed to obtain link from provider")
+	// ErrLinkNotFound is returned (wrapped) by link providers when no link
+	// matches their conditions, and by the backend when a requested link does
+	// not exist. It should be checked for via errors.Is.
+	ErrLinkNotFound error = errors.New("link not found")
+
+	errNoLink        error = errors.New("failed to obtain link from provider")
+	errNoLinks       error = errors.New("failed to obtain links from provider")
+	errAmbiguousLink error = errors.New("more than one link matches the provider conditions")
 )
 
 // Provide determines the network namespace path based on the provider's
@@ -30,8 +52,9 @@ func (lp LinkProvider) Provide() (netlink.Link, error) {
 func LPName(name string) LinkProvider {
 	return LinkProvider{
 		name: "name",
+		desc: NewDescriptor("LPName", name),
 		f: func() (netlink.Link, error) {
-			return netlink.LinkByName(name)
+			return backend.LinkByName(name)
 		},
 	}
 }
@@ -42,8 +65,9 @@ func LPName(name string) LinkProvider {
 func LPAlias(alias string) LinkProvider {
 	return LinkProvider{
 		name: "alias",
+		desc: NewDescriptor("LPAlias", alias),
 		f: func() (netlink.Link, error) {
-			return netlink.LinkByAlias(alias)
+			return backend.LinkByAlias(alias)
 		},
 	}
 }
@@ -54,8 +78,251 @@ func LPAlias(alias string) LinkProvider {
 func LPIndex(index int) LinkProvider {
 	return LinkProvider{
 		name: "index",
+		desc: NewDescriptor("LPIndex", index),
+		f: func() (netlink.Link, error) {
+			return backend.LinkByIndex(index)
+		},
+	}
+}
+
+// LPHardwareAddr creates a link provider that when called, will provide the
+// pre-existing link with the given hardware address (in the namespace this is
+// called in). If no matches or multiple matches are found, an error is
+// returned.
+func LPHardwareAddr(addr string) LinkProvider {
+	return LinkProvider{
+		name: "hardware-addr",
+		desc: NewDescriptor("LPHardwareAddr", addr),
+		f: func() (netlink.Link, error) {
+			hwAddr, err := net.ParseMAC(addr)
+			if err != nil {
+				return nil, err
+			}
+			return oneLink(linksWhere(matchHardwareAddr(hwAddr)))
+		},
+	}
+}
+
+// LPAltName creates a link provider that when called, will provide the
+// pre-existing link with the given alternative name (in the namespace this is
+// called in). If no matches are found, an error is returned.
+func LPAltName(altName string) LinkProvider {
+	return LinkProvider{
+		name: "alt-name",
+		desc: NewDescriptor("LPAltName", altName),
+		f: func() (netlink.Link, error) {
+			return oneLink(linksWhere(matchAltName(altName)))
+		},
+	}
+}
+
+// LPType creates a link provider that when called, will provide the
+// pre-existing link of the given type, such as "veth" or "bridge" (in the
+// namespace this is called in). If no matches or multiple matches are found,
+// an error is returned.
+func LPType(linkType string) LinkProvider {
+	return LinkProvider{
+		name: "type",
+		desc: NewDescriptor("LPType", linkType),
 		f: func() (netlink.Link, error) {
-			return netlink.LinkByIndex(index)
+			return oneLink(linksWhere(matchType(linkType)))
 		},
 	}
 }
+
+// LPMasterOf creates a link provider that when called, will provide the
+// pre-existing link that is enslaved to the link given by the master provider,
+// such as a bridge (in the namespace this is called in). If no matches or
+// multiple matches are found, an error is returned.
+func LPMasterOf(master LinkProvider) LinkProvider {
+	return LinkProvider{
+		name: "master-of",
+		desc: NewDescriptor("LPMasterOf", master),
+		f: func() (netlink.Link, error) {
+			m, err := master.Provide()
+			if err != nil {
+				return nil, errors.Join(errNoLink, err)
+			}
+			return oneLink(linksWhere(matchMaster(m)))
+		},
+	}
+}
+
+// LPWhere creates a link provider that when called, will provide the
+// pre-existing link for which the given function returns true (in the
+// namespace this is called in). If no matches or multiple matches are found,
+// an error is returned.
+func LPWhere(match func(netlink.Link) bool) LinkProvider {
+	return LinkProvider{
+		name: "where",
+		f: func() (netlink.Link, error) {
+			return oneLink(linksWhere(match))
+		},
+	}
+}
+
+// LPVethPeer creates a link provider that when called, will provide the peer
+// of the veth given by the provider (in the namespace this is called in). If
+// the peer is in a different namespace, an error is returned; in that case
+// NAVethPeer should be used instead.
+func LPVethPeer(veth LinkProvider) LinkProvider {
+	return LinkProvider{
+		name: "veth-peer",
+		desc: NewDescriptor("LPVethPeer", veth),
+		f: func() (netlink.Link, error) {
+			l, err := veth.Provide()
+			if err != nil {
+				return nil, errors.Join(errNoLink, err)
+			}
+			peerIndex, peerNsID, err := vethPeer(l)
+			if err != nil {
+				return nil, err
+			}
+			if peerNsID >= 0 {
+				return nil, fmt.Errorf("peer of veth %s is in another netns (netnsid %d)", l.Attrs().Name, peerNsID)
+			}
+			return backend.LinkByIndex(peerIndex)
+		},
+	}
+}
+
+// vethPeer returns the index of the peer of the given veth link, along with the
+// netnsid of the namespace the peer is in (or -1 if it is in the same
+// namespace).
+func vethPeer(l netlink.Link) (int, int, error) {
+	if l.Type() != "veth" {
+		return 0, -1, fmt.Errorf("link %s is not a veth (type %s)", l.Attrs().Name, l.Type())
+	}
+	if l.Attrs().ParentIndex <= 0 {
+		return 0, -1, fmt.Errorf("peer of veth %s is not known", l.Attrs().Name)
+	}
+	return l.Attrs().ParentIndex, l.Attrs().NetNsID, nil
+}
+
+// Provide determines the set of links based on the provider's conditions. An
+// empty set is not considered an error.
+func (lp LinksProvider) Provide() ([]netlink.Link, error) {
+	return lp.f()
+}
+
+// LPsAll creates a links provider that when called, will provide every link
+// (in the namespace this is called in).
+func LPsAll() LinksProvider {
+	return LinksProvider{
+		name: "all",
+		desc: NewDescriptor("LPsAll"),
+		f: func() ([]netlink.Link, error) {
+			return backend.LinkList()
+		},
+	}
+}
+
+// LPsType creates a links provider that when called, will provide every link
+// of the given type (in the namespace this is called in).
+func LPsType(linkType string) LinksProvider {
+	return LinksProvider{
+		name: "type",
+		desc: NewDescriptor("LPsType", linkType),
+		f: func() ([]netlink.Link, error) {
+			return linksWhere(matchType(linkType))
+		},
+	}
+}
+
+// LPsMasterOf creates a links provider that when called, will provide every
+// link that is enslaved to the link given by the master provider (in the
+// namespace this is called in).
+func LPsMasterOf(master LinkProvider) LinksProvider {
+	return LinksProvider{
+		name: "master-of",
+		desc: NewDescriptor("LPsMasterOf", master),
+		f: func() ([]netlink.Link, error) {
+			m, err := master.Provide()
+			if err != nil {
+				return nil, errors.Join(errNoLink, err)
+			}
+			return linksWhere(matchMaster(m))
+		},
+	}
+}
+
+// LPsWhere creates a links provider that when called, will provide every link
+// for which the given function returns true (in the namespace this is called
+// in).
+func LPsWhere(match func(netlink.Link) bool) LinksProvider {
+	return LinksProvider{
+		name: "where",
+		f: func() ([]netlink.Link, error) {
+			return linksWhere(match)
+		},
+	}
+}
+
+// linksWhere lists the links in the current namespace for which the given
+// function returns true.
+func linksWhere(match func(netlink.Link) bool) ([]netlink.Link, error) {
+	links, err := backend.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list links: %w", err)
+	}
+	matches := make([]netlink.Link, 0)
+	for _, l := range links {
+		if match(l) {
+			matches = append(matches, l)
+		}
+	}
+	return matches, nil
+}
+
+// oneLink returns the only link in the given set, erroring if the set does not
+// contain exactly one link.
+func oneLink(links []netlink.Link, err error) (netlink.Link, error) {
+	if err != nil {
+		return nil, err
+	}
+	switch len(links) {
+	case 0:
+		return nil, fmt.Errorf("%w: no link matches the provider conditions", ErrLinkNotFound)
+	case 1:
+		return links[0], nil
+	default:
+		names := make([]string, len(links))
+		for idx, l := range links {
+			names[idx] = l.Attrs().Name
+		}
+		return nil, fmt.Errorf("%w: %v", errAmbiguousLink, names)
+	}
+}
+
+// matchHardwareAddr matches links with the given hardware address.
+func matchHardwareAddr(addr net.HardwareAddr) func(netlink.Link) bool {
+	return func(l netlink.Link) bool {
+		return bytes.Equal(l.Attrs().HardwareAddr, addr)
+	}
+}
+
+// matchAltName matches links that have the given alternative name.
+func matchAltName(altName string) func(netlink.Link) bool {
+	return func(l netlink.Link) bool {
+		for _, n := range l.Attrs().AltNames {
+			if n == altName {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// matchType matches links of the given type.
+func matchType(linkType string) func(netlink.Link) bool {
+	return func(l netlink.Link) bool {
+		return l.Type() == linkType
+	}
+}
+
+// matchMaster matches links that are enslaved to the given master link.
+func matchMaster(master netlink.Link) func(netlink.Link) bool {
+	return func(l netlink.Link) bool {
+		return l.Attrs().MasterIndex == master.Attrs().Index
+	}
+}
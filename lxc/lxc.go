@@ -0,0 +1,83 @@
+package lxc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/willfantom/neslink"
+)
+
+const (
+	// infoCommand is the LXC tool used to query the runtime state of a
+	// container.
+	infoCommand string = "lxc-info"
+)
+
+func init() {
+	neslink.RegisterNsProvider("lxc.NPContainerAt", func(d neslink.Descriptor) (neslink.NsProvider, error) {
+		var lxcpath, name string
+		if err := d.Args(&lxcpath, &name); err != nil {
+			return neslink.NsProvider{}, err
+		}
+		return NPContainerAt(lxcpath, name), nil
+	})
+}
+
+// NPContainer returns a netns provider that provides the netns path for the
+// running LXC container with the given name, in the default LXC path of the
+// caller.
+func NPContainer(name string) neslink.NsProvider {
+	return NPContainerAt("", name)
+}
+
+// NPContainerAt returns a netns provider that provides the netns path for the
+// running LXC container with the given name, in the given LXC path (such as
+// /var/lib/lxc). If the path is empty, the default LXC path of the caller is
+// used. The container's init process is found via lxc-info, which asks the
+// container's monitor over the LXC command socket, so lxc-info must be
+// installed.
+func NPContainerAt(lxcpath, name string) neslink.NsProvider {
+	return neslink.NPGeneric(
+		"lxc-container",
+		func() (neslink.Namespace, error) {
+			pid, err := initPid(lxcpath, name)
+			if err != nil {
+				return neslink.Namespace(""), fmt.Errorf("failed to get init of lxc container %s: %w", name, err)
+			}
+			return neslink.NPProcess(pid).Provide()
+		},
+	).WithDescriptor(neslink.NewDescriptor("lxc.NPContainerAt", lxcpath, name))
+}
+
+// initPid gets the pid of the init process of the named container from the
+// runtime state of LXC.
+func initPid(lxcpath, name string) (int, error) {
+	args := []string{"--no-humanize", "--pid", "--name", name}
+	if lxcpath != "" {
+		args = append(args, "--lxcpath", lxcpath)
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(infoCommand, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && stderr.Len() > 0 {
+			return 0, fmt.Errorf("%s failed: %s", infoCommand, strings.TrimSpace(stderr.String()))
+		}
+		return 0, fmt.Errorf("failed to run %s: %w", infoCommand, err)
+	}
+	output := strings.TrimSpace(string(out))
+	if output == "" {
+		return 0, fmt.Errorf("container is not running")
+	}
+	pid, err := strconv.Atoi(output)
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("unexpected output from %s: %q", infoCommand, output)
+	}
+	return pid, nil
+}
@@ -0,0 +1,11 @@
+package neslink_test
+
+import (
+	"testing"
+
+	"github.com/willfantom/neslink/neslinktest"
+)
+
+func TestMain(m *testing.M) {
+	neslinktest.Main(m)
+}
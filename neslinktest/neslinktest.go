@@ -0,0 +1,128 @@
+// Package neslinktest provides a harness for testing code built on neslink
+// against the real kernel without privileges. The test binary is re-executed
+// in a fresh user, network and mount namespace, where it is mapped to root, so
+// that namespaces and links can be created freely and nothing leaks onto the
+// host. To use it, call Main from TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		neslinktest.Main(m)
+//	}
+//
+// Tests that need the namespace should call Require, and use MountDir as the
+// mount directory for any named namespaces they create.
+package neslinktest
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// envChild is set in the environment of the re-executed test binary.
+	envChild string = "NESLINKTEST_CHILD"
+
+	// envUnavailable is set (with the reason) when the test binary could not
+	// be re-executed in a new namespace, and the tests are run as is.
+	envUnavailable string = "NESLINKTEST_UNAVAILABLE"
+)
+
+// Main runs the tests in m inside a new user, network and mount namespace,
+// exiting with the result. If the namespaces can not be created (for example
+// if unprivileged user namespaces are disabled), the tests are run in the
+// current namespaces instead, and any that call Require are skipped.
+func Main(m *testing.M) {
+	if InNamespace() {
+		if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+			fmt.Fprintf(os.Stderr, "neslinktest: failed to make mounts private: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(m.Run())
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		os.Exit(runUnavailable(m, fmt.Errorf("failed to find test binary: %w", err)))
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), envChild+"=1")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNET | syscall.CLONE_NEWNS,
+		UidMappings: []syscall.SysProcIDMap{
+			{ContainerID: 0, HostID: os.Getuid(), Size: 1},
+		},
+		GidMappings: []syscall.SysProcIDMap{
+			{ContainerID: 0, HostID: os.Getgid(), Size: 1},
+		},
+		GidMappingsEnableSetgroups: false,
+	}
+	if err := cmd.Start(); err != nil {
+		os.Exit(runUnavailable(m, fmt.Errorf("failed to start test binary in new namespaces: %w", err)))
+	}
+	if err := cmd.Wait(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() >= 0 {
+			os.Exit(exitErr.ExitCode())
+		}
+		fmt.Fprintf(os.Stderr, "neslinktest: test binary failed: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// runUnavailable runs the tests in the current namespaces, recording why the
+// new namespaces are unavailable for Require.
+func runUnavailable(m *testing.M, reason error) int {
+	os.Setenv(envUnavailable, reason.Error())
+	return m.Run()
+}
+
+// InNamespace reports whether the caller is running inside the namespaces
+// created by Main.
+func InNamespace() bool {
+	return os.Getenv(envChild) != ""
+}
+
+// Require skips the test unless it is running inside the namespaces created by
+// Main.
+func Require(t testing.TB) {
+	t.Helper()
+	if InNamespace() {
+		return
+	}
+	if reason := os.Getenv(envUnavailable); reason != "" {
+		t.Skipf("neslinktest namespaces are unavailable: %s", reason)
+	}
+	t.Skip("test must be run via neslinktest.Main")
+}
+
+// MountDir returns a new temporary directory for use as the mount directory of
+// named namespaces (such as with NANewNsAt). When the test finishes, any
+// namespaces still mounted in the directory are unmounted before the directory
+// is removed.
+func MountDir(t testing.TB) string {
+	t.Helper()
+	dir := t.TempDir()
+	// cleanups run in reverse, so this runs before the directory is removed
+	t.Cleanup(func() {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Errorf("failed to read mount dir: %v", err)
+			return
+		}
+		for _, e := range entries {
+			p := filepath.Join(dir, e.Name())
+			if err := unix.Unmount(p, unix.MNT_DETACH); err != nil && !errors.Is(err, unix.EINVAL) {
+				t.Errorf("failed to unmount %s: %v", p, err)
+			}
+		}
+	})
+	return dir
+}
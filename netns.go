@@ -1,6 +1,9 @@
 package neslink
 
-import "os"
+import (
+	"fmt"
+	"os"
+)
 
 // Namespace is a path to a file associated with a network namespace.
 type Namespace string
@@ -8,6 +11,14 @@ type Namespace string
 // NsFd is a file descriptor for an open Namespace file.
 type NsFd int
 
+// NsID identifies a network namespace by the device and inode of its nsfs
+// file. Unlike a Namespace path, two NsIDs are equal if and only if they refer
+// to the same network namespace, regardless of how the namespace was found.
+type NsID struct {
+	Dev   uint64
+	Inode uint64
+}
+
 const (
 	NsFdNone         NsFd   = NsFd(-1)
 	DefaultMountPath string = "/run/netns"
@@ -29,13 +40,33 @@ func (n NsFd) Valid() bool {
 	return n.Int() > 0
 }
 
-// Exists determines if the path used for the namespace exists. Whilst not an
-// exhaustive check, this can help debug namespace providers.
+// Exists determines if the path used for the namespace exists and is not a
+// directory. Whilst not an exhaustive check, this can help debug namespace
+// providers. For a check that the path is a network namespace, see Validate.
 func (ns Namespace) Exists() bool {
-	if info, err := os.Stat(ns.String()); err != nil {
-		if !info.IsDir() {
-			return true
-		}
+	info, err := os.Stat(ns.String())
+	if err != nil {
+		return false
+	}
+	return !info.IsDir()
+}
+
+// String returns the NsID in the form used by the kernel in /proc symlinks,
+// prefixed with the device number.
+func (id NsID) String() string {
+	return fmt.Sprintf("%d:net:[%d]", id.Dev, id.Inode)
+}
+
+// Equal determines if the other namespace path refers to the same network
+// namespace as this one, by comparing the identity of both.
+func (ns Namespace) Equal(other Namespace) (bool, error) {
+	a, err := ns.ID()
+	if err != nil {
+		return false, err
+	}
+	b, err := other.ID()
+	if err != nil {
+		return false, err
 	}
-	return false
+	return a == b, nil
 }
@@ -4,11 +4,19 @@
 package neslink
 
 import (
+	"errors"
 	"fmt"
 
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
 	"golang.org/x/sys/unix"
 )
 
+const (
+	// nsGetNsType is the NS_GET_NSTYPE ioctl request, _IO(0xb7, 0x3).
+	nsGetNsType uint = 0xb703
+)
+
 // close closes the file descriptor. This should be used to clean up any opned
 // file descriptor.
 func (n NsFd) close() error {
@@ -33,3 +41,82 @@ func (ns Namespace) open() (NsFd, error) {
 func (ns NsFd) set() error {
 	return unix.Setns(ns.Int(), unix.CLONE_NEWNET)
 }
+
+// ID returns the identity of the network namespace at the path.
+func (ns Namespace) ID() (NsID, error) {
+	var stat unix.Stat_t
+	if err := unix.Stat(ns.String(), &stat); err != nil {
+		return NsID{}, fmt.Errorf("failed to stat namespace: %w", err)
+	}
+	return NsID{Dev: uint64(stat.Dev), Inode: stat.Ino}, nil
+}
+
+// ID returns the identity of the network namespace associated with the file
+// descriptor.
+func (n NsFd) ID() (NsID, error) {
+	var stat unix.Stat_t
+	if err := unix.Fstat(n.Int(), &stat); err != nil {
+		return NsID{}, fmt.Errorf("failed to stat netns file descriptor %d: %w", n.Int(), err)
+	}
+	return NsID{Dev: uint64(stat.Dev), Inode: stat.Ino}, nil
+}
+
+// NetNsID returns the netnsid that the network namespace associated with the
+// file descriptor has assigned to the target network namespace. If no id has
+// been assigned, -1 is returned.
+func (n NsFd) NetNsID(target NsFd) (int, error) {
+	h, err := netlink.NewHandleAt(netns.NsHandle(n.Int()))
+	if err != nil {
+		return -1, fmt.Errorf("failed to create netlink handle in netns: %w", err)
+	}
+	defer h.Delete()
+	nsid, err := h.GetNetNsIdByFd(target.Int())
+	if err != nil {
+		return -1, fmt.Errorf("failed to get netnsid: %w", err)
+	}
+	return nsid, nil
+}
+
+// SetNetNsID assigns the given netnsid to the target network namespace, as seen
+// from the network namespace associated with the file descriptor. The kernel
+// will refuse this if the target already has an id assigned.
+func (n NsFd) SetNetNsID(target NsFd, nsid int) error {
+	h, err := netlink.NewHandleAt(netns.NsHandle(n.Int()))
+	if err != nil {
+		return fmt.Errorf("failed to create netlink handle in netns: %w", err)
+	}
+	defer h.Delete()
+	if err := h.SetNetNsIdByFd(target.Int(), nsid); err != nil {
+		return fmt.Errorf("failed to set netnsid: %w", err)
+	}
+	return nil
+}
+
+// Validate checks that the path is that of a network namespace. The type of
+// the namespace is determined via the NS_GET_NSTYPE ioctl, falling back to
+// checking the file is on nsfs for kernels that do not support it (pre 4.11).
+func (ns Namespace) Validate() error {
+	fd, err := ns.open()
+	if err != nil {
+		return err
+	}
+	defer fd.close()
+	nsType, err := unix.IoctlRetInt(fd.Int(), nsGetNsType)
+	if err == nil {
+		if nsType != unix.CLONE_NEWNET {
+			return fmt.Errorf("%s is not a network namespace (type %#x)", ns, nsType)
+		}
+		return nil
+	}
+	if !errors.Is(err, unix.ENOTTY) && !errors.Is(err, unix.EINVAL) {
+		return fmt.Errorf("failed to get namespace type: %w", err)
+	}
+	var fs unix.Statfs_t
+	if err := unix.Fstatfs(fd.Int(), &fs); err != nil {
+		return fmt.Errorf("failed to stat namespace filesystem: %w", err)
+	}
+	if fs.Type != unix.NSFS_MAGIC {
+		return fmt.Errorf("%s is not a namespace", ns)
+	}
+	return nil
+}
@@ -27,3 +27,31 @@ func (ns Namespace) open() (NsFd, error) {
 func (ns NsFd) set() error {
 	fmt.Errorf("netns can not be set on non-linux builds")
 }
+
+// ID returns the identity of the network namespace at the path.
+func (ns Namespace) ID() (NsID, error) {
+	return NsID{}, fmt.Errorf("netns identity can not be obtained on non-linux builds")
+}
+
+// ID returns the identity of the network namespace associated with the file
+// descriptor.
+func (n NsFd) ID() (NsID, error) {
+	return NsID{}, fmt.Errorf("netns identity can not be obtained on non-linux builds")
+}
+
+// NetNsID returns the netnsid that the network namespace associated with the
+// file descriptor has assigned to the target network namespace.
+func (n NsFd) NetNsID(target NsFd) (int, error) {
+	return -1, fmt.Errorf("netnsid can not be obtained on non-linux builds")
+}
+
+// SetNetNsID assigns the given netnsid to the target network namespace, as seen
+// from the network namespace associated with the file descriptor.
+func (n NsFd) SetNetNsID(target NsFd, nsid int) error {
+	return fmt.Errorf("netnsid can not be set on non-linux builds")
+}
+
+// Validate checks that the path is that of a network namespace.
+func (ns Namespace) Validate() error {
+	return fmt.Errorf("netns can not be validated on non-linux builds")
+}
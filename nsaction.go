@@ -3,8 +3,10 @@ package neslink
 import (
 	"errors"
 	"fmt"
-	"os"
+	"io/fs"
+	"net"
 	"path"
+	"time"
 
 	"github.com/vishvananda/netlink"
 	"github.com/willfantom/nescript"
@@ -23,6 +25,7 @@ import (
 type NsAction struct {
 	actionName string
 	f          func() error
+	desc       Descriptor
 }
 
 // name simply returns the name of the netns action.
@@ -56,38 +59,9 @@ func NAGeneric(name string, function func() error) NsAction {
 func NANewNsAt(mountdir, name string) NsAction {
 	return NsAction{
 		actionName: "new-ns-at",
+		desc:       NewDescriptor("NANewNsAt", mountdir, name),
 		f: func() error {
-			// 1. create the mounting dir if required
-			if _, err := os.Stat(mountdir); os.IsNotExist(err) {
-				if err := os.MkdirAll(mountdir, 0o755); err != nil {
-					return err
-				}
-			}
-
-			// 2. create the mount file (error if already exists)
-			mountpath := path.Join(mountdir, name)
-			if _, err := os.Stat(mountpath); os.IsNotExist(err) {
-				mf, err := os.OpenFile(mountpath, os.O_CREATE|os.O_EXCL, 0o444)
-				if err != nil {
-					return fmt.Errorf("failed to create namespace mount file: %w", err)
-				}
-				mf.Close()
-			} else {
-				return fmt.Errorf("namespace mount file already exists")
-			}
-
-			// 3. create new ns and move current pid/tid to it
-			if err := unix.Unshare(unix.CLONE_NEWNET); err != nil {
-				return fmt.Errorf("failed to create and switch to newnets: %w", err)
-			}
-
-			// 4. bind the new ns to the mount file
-			ns, _ := NPNow().Provide()
-			if err := unix.Mount(ns.String(), mountpath, "bind", unix.MS_BIND, ""); err != nil {
-				return fmt.Errorf("failed to mount new netns to mount file: %w", err)
-			}
-
-			return nil
+			return backend.NewNsAt(path.Join(mountdir, name))
 		},
 	}
 }
@@ -98,18 +72,59 @@ func NANewNsAt(mountdir, name string) NsAction {
 func NANewNs(name string) NsAction {
 	return NsAction{
 		actionName: "new-ns-at",
+		desc:       NewDescriptor("NANewNs", name),
 		f: func() error {
 			return NANewNsAt(DefaultMountPath, name).act()
 		},
 	}
 }
 
+// NAEnsureNsAt creates a new network namespace bound to the named file in the
+// given directory, unless the file is already a bound netns, in which case it
+// switches to the existing netns instead. Either way, any action that is
+// performed after this action executes successfully will be executed within
+// the netns. If the file exists but is not a netns, an error wrapping
+// ErrConflict is returned.
+func NAEnsureNsAt(mountdir, name string) NsAction {
+	return NsAction{
+		actionName: "ensure-ns-at",
+		desc:       NewDescriptor("NAEnsureNsAt", mountdir, name),
+		f: func() error {
+			ns := Namespace(path.Join(mountdir, name))
+			nsfd, err := backend.OpenNs(ns)
+			if errors.Is(err, fs.ErrNotExist) {
+				return NANewNsAt(mountdir, name).act()
+			} else if err != nil {
+				return fmt.Errorf("failed to open the existing netns: %w", err)
+			}
+			defer backend.CloseNs(nsfd)
+			if err := backend.ValidateNs(ns); err != nil {
+				return fmt.Errorf("%w: %s is not a netns: %w", ErrConflict, ns, err)
+			}
+			return backend.SetNs(nsfd)
+		},
+	}
+}
+
+// NAEnsureNs is NAEnsureNsAt for a netns bound to a named file in the default
+// mount path.
+func NAEnsureNs(name string) NsAction {
+	return NsAction{
+		actionName: "ensure-ns",
+		desc:       NewDescriptor("NAEnsureNs", name),
+		f: func() error {
+			return NAEnsureNsAt(DefaultMountPath, name).act()
+		},
+	}
+}
+
 // NASetLinkNs moves a link provided by the given link provider to the namespace
 // provided by the ns provider. The link itself should br present in the
 // namespace in which the wrapping NsDo is set to execute in.
 func NASetLinkNs(lP LinkProvider, nsP NsProvider) NsAction {
 	return NsAction{
 		actionName: "set-link-ns",
+		desc:       NewDescriptor("NASetLinkNs", lP, nsP),
 		f: func() error {
 			link, err := lP.Provide()
 			if err != nil {
@@ -119,12 +134,12 @@ func NASetLinkNs(lP LinkProvider, nsP NsProvider) NsAction {
 			if err != nil {
 				return fmt.Errorf("failed to get target netns for link from provider: %w", err)
 			}
-			nsfd, err := ns.open()
+			nsfd, err := backend.OpenNs(ns)
 			if err != nil {
 				return fmt.Errorf("failed to open target netns for link from provider: %w", err)
 			}
-			defer nsfd.close()
-			return netlink.LinkSetNsFd(link, nsfd.Int())
+			defer backend.CloseNs(nsfd)
+			return backend.LinkSetNsFd(link, nsfd.Int())
 		},
 	}
 }
@@ -140,11 +155,11 @@ func NAGetNsFd(nsfd *NsFd) NsAction {
 			if err != nil {
 				return fmt.Errorf("failed to get netns from provider: %w", err)
 			}
-			fd, err := ns.open()
+			fd, err := backend.OpenNs(ns)
 			if err != nil {
 				return err
 			}
-			*nsfd = NsFd(fd)
+			*nsfd = fd
 			return nil
 		},
 	}
@@ -175,8 +190,9 @@ func NAExecNescript(script nescript.Script, subcommand []string, process *nescri
 func NALinks(links *[]netlink.Link) NsAction {
 	return NsAction{
 		actionName: "get-ns-links",
+		desc:       NewDescriptor("NALinks"),
 		f: func() error {
-			l, err := netlink.LinkList()
+			l, err := backend.LinkList()
 			if err != nil {
 				return err
 			}
@@ -186,21 +202,33 @@ func NALinks(links *[]netlink.Link) NsAction {
 	}
 }
 
+// NAAddrs gets the addresses of the given family (such as netlink.FAMILY_V4,
+// or netlink.FAMILY_ALL) on every link in the netns it is called in.
+func NAAddrs(family int, addrs *[]netlink.Addr) NsAction {
+	return NsAction{
+		actionName: "get-ns-addrs",
+		desc:       NewDescriptor("NAAddrs", family),
+		f: func() error {
+			a, err := backend.AddrList(nil, family)
+			if err != nil {
+				return err
+			}
+			*addrs = a
+			return nil
+		},
+	}
+}
+
 // NADeleteNamedAt when executed removes the named netns if it exists.
 // Importantly, the netns is not removed until the tread exists (at the end of
 // the do call).
 func NADeleteNamedAt(mountdir, name string) NsAction {
 	return NsAction{
 		actionName: "delete-named-ns-at",
+		desc:       NewDescriptor("NADeleteNamedAt", mountdir, name),
 		f: func() error {
 			mountpath := path.Join(mountdir, name)
-			if err := unix.Unmount(mountpath, unix.MNT_DETACH); err != nil {
-				return fmt.Errorf("failed to unmount netns: %w", err)
-			}
-			if err := os.Remove(mountpath); err != nil {
-				return fmt.Errorf("failed to remove netns mount file: %w", err)
-			}
-			return nil
+			return backend.DeleteNsAt(mountpath)
 		},
 	}
 }
@@ -211,6 +239,7 @@ func NADeleteNamedAt(mountdir, name string) NsAction {
 func NADeleteNamed(name string) NsAction {
 	return NsAction{
 		actionName: "delete-named-ns-at",
+		desc:       NewDescriptor("NADeleteNamed", name),
 		f: func() error {
 			return NADeleteNamedAt(DefaultMountPath, name).act()
 		},
@@ -223,6 +252,7 @@ func NADeleteNamed(name string) NsAction {
 func NAGetLink(provider LinkProvider, link *netlink.Link) NsAction {
 	return NsAction{
 		actionName: "get-ns-link",
+		desc:       NewDescriptor("NAGetLink", provider),
 		f: func() error {
 			l, err := provider.Provide()
 			if err != nil {
@@ -234,6 +264,215 @@ func NAGetLink(provider LinkProvider, link *netlink.Link) NsAction {
 	}
 }
 
+// NAGetNetNsID gets the netnsid that the netns it is called in has assigned to
+// the netns obtained from the given provider. This is the id that appears as
+// the link-netnsid of links (such as veths) that have a peer in the target
+// netns. If no id has been assigned, the result is -1.
+func NAGetNetNsID(nsP NsProvider, nsid *int) NsAction {
+	return NsAction{
+		actionName: "get-netnsid",
+		desc:       NewDescriptor("NAGetNetNsID", nsP),
+		f: func() error {
+			current, target, err := openNowAndTarget(nsP)
+			if err != nil {
+				return err
+			}
+			defer backend.CloseNs(current)
+			defer backend.CloseNs(target)
+			id, err := backend.NetNsID(current, target)
+			if err != nil {
+				return err
+			}
+			*nsid = id
+			return nil
+		},
+	}
+}
+
+// NASetNetNsID assigns a netnsid to the netns obtained from the given provider,
+// as seen from the netns it is called in. This fails if the target netns has
+// already been assigned an id.
+func NASetNetNsID(nsP NsProvider, nsid int) NsAction {
+	return NsAction{
+		actionName: "set-netnsid",
+		desc:       NewDescriptor("NASetNetNsID", nsP, nsid),
+		f: func() error {
+			current, target, err := openNowAndTarget(nsP)
+			if err != nil {
+				return err
+			}
+			defer backend.CloseNs(current)
+			defer backend.CloseNs(target)
+			return backend.SetNetNsID(current, target, nsid)
+		},
+	}
+}
+
+// openNowAndTarget opens both the netns of the calling thread and the netns
+// from the given provider. Both should be closed by the caller.
+func openNowAndTarget(nsP NsProvider) (NsFd, NsFd, error) {
+	now, _ := NPNow().Provide()
+	current, err := backend.OpenNs(now)
+	if err != nil {
+		return NsFdNone, NsFdNone, fmt.Errorf("failed to open current netns: %w", err)
+	}
+	ns, err := nsP.Provide()
+	if err != nil {
+		backend.CloseNs(current)
+		return NsFdNone, NsFdNone, errors.Join(errNoNs, err)
+	}
+	target, err := backend.OpenNs(ns)
+	if err != nil {
+		backend.CloseNs(current)
+		return NsFdNone, NsFdNone, fmt.Errorf("failed to open target netns: %w", err)
+	}
+	return current, target, nil
+}
+
+// NAVethPeer resolves the other end of the veth given by the link provider,
+// even if it is in another netns. The peer's netns is found via the netnsid
+// the current netns has assigned to it, and its link via the peer's index. The
+// resulting providers are stored in the given parameters so that they can be
+// used in a later Do call. As the peer netns is resolved to a path when this
+// action is called, the providers remain valid only whilst that path does.
+func NAVethPeer(lP LinkProvider, peerNs *NsProvider, peerLink *LinkProvider) NsAction {
+	return NsAction{
+		actionName: "get-veth-peer",
+		desc:       NewDescriptor("NAVethPeer", lP),
+		f: func() error {
+			l, err := lP.Provide()
+			if err != nil {
+				return errors.Join(errNoLink, err)
+			}
+			peerIndex, peerNsID, err := vethPeer(l)
+			if err != nil {
+				return err
+			}
+			nsP := NPNetNsID(NPNow(), peerNsID)
+			if peerNsID < 0 {
+				// the thread path of the current netns is only valid during the
+				// do call, so a longer lived path is required
+				nsP = NPSameAs(NPNow())
+			}
+			ns, err := nsP.Provide()
+			if err != nil {
+				return fmt.Errorf("failed to find netns of veth peer: %w", err)
+			}
+			*peerNs = NPPath(ns.String())
+			*peerLink = LPIndex(peerIndex)
+			return nil
+		},
+	}
+}
+
+// FouConfig describes a FOU or GUE receive port. If GUE is false, packets
+// received on the port are decapsulated as plain FOU and handed to the given
+// IP protocol (such as 4 for ipip or 47 for gre). IPv6 should be set for ports
+// that receive over IPv6.
+type FouConfig struct {
+	Port     int
+	Protocol int
+	GUE      bool
+	IPv6     bool
+}
+
+// fou converts the config into the form used by netlink.
+func (fc FouConfig) fou() netlink.Fou {
+	f := netlink.Fou{
+		Family:    unix.AF_INET,
+		Port:      fc.Port,
+		Protocol:  fc.Protocol,
+		EncapType: netlink.FOU_ENCAP_DIRECT,
+	}
+	if fc.IPv6 {
+		f.Family = unix.AF_INET6
+	}
+	if fc.GUE {
+		f.EncapType = netlink.FOU_ENCAP_GUE
+		f.Protocol = 0
+	}
+	return f
+}
+
+// NAAddFou adds a FOU or GUE receive port in the netns it is called in, for
+// use with tunnels that are configured with a TunnelEncap.
+func NAAddFou(config FouConfig) NsAction {
+	return NsAction{
+		actionName: "add-fou",
+		desc:       NewDescriptor("NAAddFou", config),
+		f: func() error {
+			return backend.FouAdd(config.fou())
+		},
+	}
+}
+
+// NADelFou removes a FOU or GUE receive port from the netns it is called in.
+func NADelFou(config FouConfig) NsAction {
+	return NsAction{
+		actionName: "del-fou",
+		desc:       NewDescriptor("NADelFou", config),
+		f: func() error {
+			return backend.FouDel(config.fou())
+		},
+	}
+}
+
+// NAWaitRoute waits for up to the given timeout for a route to the given
+// destination (in CIDR notation, or "default") to be present in the main
+// routing table of the netns it is called in. A timeout of 0 waits
+// indefinitely.
+func NAWaitRoute(dst string, timeout time.Duration) NsAction {
+	return NsAction{
+		actionName: "wait-route",
+		desc:       NewDescriptor("NAWaitRoute", dst, timeout),
+		f: func() error {
+			family := netlink.FAMILY_ALL
+			var dstNet *net.IPNet
+			if dst != "default" {
+				_, ipNet, err := net.ParseCIDR(dst)
+				if err != nil {
+					return fmt.Errorf("failed to parse route destination: %w", err)
+				}
+				dstNet = ipNet
+				if family = netlink.FAMILY_V6; ipNet.IP.To4() != nil {
+					family = netlink.FAMILY_V4
+				}
+			}
+			return waitUntil(timeout, "route to "+dst,
+				backend.RouteSubscribe,
+				func() (bool, error) {
+					routes, err := backend.RouteList(nil, family)
+					if err != nil {
+						return false, fmt.Errorf("failed to list routes: %w", err)
+					}
+					for _, r := range routes {
+						if routeDstEqual(r.Dst, dstNet) {
+							return true, nil
+						}
+					}
+					return false, nil
+				},
+			)
+		},
+	}
+}
+
+// routeDstEqual checks if the two route destinations are the same, where a nil
+// or zero length prefix is the default route.
+func routeDstEqual(a, b *net.IPNet) bool {
+	aOnes, bOnes := 0, 0
+	if a != nil {
+		aOnes, _ = a.Mask.Size()
+	}
+	if b != nil {
+		bOnes, _ = b.Mask.Size()
+	}
+	if aOnes == 0 || bOnes == 0 {
+		return aOnes == bOnes
+	}
+	return aOnes == bOnes && a.IP.Equal(b.IP)
+}
+
 // func NADumpFilepath() NsAction {
 // 	return NsAction{
 // 		actionName: "dump-file-path",
@@ -0,0 +1,15 @@
+package neslink
+
+// NsInfo describes a distinct network namespace found on the host. Along with a
+// provider that can be used to target the namespace in a Do call, the process
+// IDs and mount names that were found to reference the namespace are included.
+// Tids only includes threads that are in a different network namespace to
+// their process.
+type NsInfo struct {
+	ID       NsID
+	Provider NsProvider
+	Pids     []int
+	Tids     []int
+	Names    []string
+	Paths    []string
+}
@@ -0,0 +1,261 @@
+//go:build linux
+// +build linux
+
+package neslink
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	procPath      string = "/proc"
+	mountInfoPath string = "/proc/self/mountinfo"
+	nsfsType      string = "nsfs"
+)
+
+// nsScan collects namespace information during a call to ListNamespaces. The
+// paths and names recorded so far are kept in sets so that recording each one
+// does not require a scan of those already recorded.
+type nsScan struct {
+	found map[NsID]*NsInfo
+	paths map[string]bool
+	names map[nsName]bool
+}
+
+// nsName is a name recorded against a namespace.
+type nsName struct {
+	id   NsID
+	name string
+}
+
+// ListNamespaces returns every distinct network namespace that can be found on
+// the host, deduplicated by the device and inode of the namespace. Namespaces
+// are discovered by scanning the default mount directory, any additional mount
+// directories given, the netns of every process and thread in /proc, and any
+// nsfs bind mounts listed in /proc/self/mountinfo. Entries that can not be
+// read (such as processes that exit mid-scan or are not accessible to the
+// caller) are skipped.
+func ListNamespaces(mountdirs ...string) ([]NsInfo, error) {
+	scan := nsScan{
+		found: make(map[NsID]*NsInfo),
+		paths: make(map[string]bool),
+		names: make(map[nsName]bool),
+	}
+
+	// 1. mounted (named) namespaces
+	for _, dir := range append([]string{DefaultMountPath}, mountdirs...) {
+		if err := scan.mountDir(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	// 2. nsfs bind mounts not already found in the mount directories
+	if err := scan.mountInfo(); err != nil {
+		return nil, err
+	}
+
+	// 3. processes and threads
+	if err := scan.procs(); err != nil {
+		return nil, err
+	}
+
+	infos := make([]NsInfo, 0, len(scan.found))
+	for _, info := range scan.found {
+		infos = append(infos, *info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].ID.Dev != infos[j].ID.Dev {
+			return infos[i].ID.Dev < infos[j].ID.Dev
+		}
+		return infos[i].ID.Inode < infos[j].ID.Inode
+	})
+	return infos, nil
+}
+
+// add stats the given namespace path and records it against the namespace it
+// references, creating a new entry if required. The provider of the entry is
+// set from the first path recorded for the namespace. False is returned if the
+// path could not be used.
+func (s *nsScan) add(nsPath string, provider func() NsProvider) (*NsInfo, bool) {
+	id, err := Namespace(nsPath).ID()
+	if err != nil {
+		return nil, false
+	}
+	return s.addID(id, nsPath, provider), true
+}
+
+// addID records the given namespace path against the namespace with the given
+// identity, creating a new entry if required.
+func (s *nsScan) addID(id NsID, nsPath string, provider func() NsProvider) *NsInfo {
+	info, ok := s.found[id]
+	if !ok {
+		info = &NsInfo{
+			ID:       id,
+			Provider: provider(),
+		}
+		s.found[id] = info
+	}
+	if !s.paths[nsPath] {
+		s.paths[nsPath] = true
+		info.Paths = append(info.Paths, nsPath)
+	}
+	return info
+}
+
+// addName records the given name against the namespace of the given entry, if
+// it is not already recorded.
+func (s *nsScan) addName(info *NsInfo, name string) {
+	key := nsName{id: info.ID, name: name}
+	if s.names[key] {
+		return
+	}
+	s.names[key] = true
+	info.Names = append(info.Names, name)
+}
+
+// mountDir records every namespace mounted in the given directory. A missing
+// directory is not considered an error.
+func (s *nsScan) mountDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read netns mount directory %s: %w", dir, err)
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		mountpath := path.Join(dir, e.Name())
+		if !isNsfs(mountpath) {
+			continue
+		}
+		if info, ok := s.add(mountpath, func() NsProvider { return NPNameAt(dir, e.Name()) }); ok {
+			s.addName(info, e.Name())
+		}
+	}
+	return nil
+}
+
+// mountInfo records every network namespace that is bind mounted according to
+// the mountinfo of the calling process.
+func (s *nsScan) mountInfo() error {
+	f, err := os.Open(mountInfoPath)
+	if err != nil {
+		return fmt.Errorf("failed to open mountinfo: %w", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		mountpoint, ok := parseNetMountInfo(scanner.Text())
+		if !ok {
+			continue
+		}
+		if info, ok := s.add(mountpoint, func() NsProvider { return NPPath(mountpoint) }); ok {
+			s.addName(info, path.Base(mountpoint))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read mountinfo: %w", err)
+	}
+	return nil
+}
+
+// procs records the network namespace of every process, and of any thread
+// that is in a different network namespace to its process. Processes are all
+// recorded before threads so that namespace providers prefer processes.
+func (s *nsScan) procs() error {
+	entries, err := os.ReadDir(procPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", procPath, err)
+	}
+	pids := make(map[int]NsID, len(entries))
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		pidNs := path.Join(procPath, e.Name(), "ns", "net")
+		if info, ok := s.add(pidNs, func() NsProvider { return NPProcess(pid) }); ok {
+			info.Pids = append(info.Pids, pid)
+			pids[pid] = info.ID
+		}
+	}
+	for pid, pidID := range pids {
+		tasks, err := os.ReadDir(path.Join(procPath, strconv.Itoa(pid), "task"))
+		if err != nil {
+			continue
+		}
+		for _, t := range tasks {
+			tid, err := strconv.Atoi(t.Name())
+			if err != nil || tid == pid {
+				continue
+			}
+			tidNs := path.Join(procPath, strconv.Itoa(pid), "task", t.Name(), "ns", "net")
+			id, err := Namespace(tidNs).ID()
+			if err != nil || id == pidID {
+				continue
+			}
+			info := s.addID(id, tidNs, func() NsProvider { return NPThread(pid, tid) })
+			info.Tids = append(info.Tids, tid)
+		}
+	}
+	return nil
+}
+
+// parseNetMountInfo parses a single line of a mountinfo file, returning the
+// mount point if the line describes a bind mounted network namespace.
+func parseNetMountInfo(line string) (string, bool) {
+	// see proc(5): fields before the " - " separator are variable in length
+	pre, post, found := strings.Cut(line, " - ")
+	if !found {
+		return "", false
+	}
+	preFields := strings.Fields(pre)
+	postFields := strings.Fields(post)
+	if len(preFields) < 5 || len(postFields) < 1 {
+		return "", false
+	}
+	if postFields[0] != nsfsType || !strings.HasPrefix(preFields[3], "net:") {
+		return "", false
+	}
+	return unescapeMountInfo(preFields[4]), true
+}
+
+// unescapeMountInfo replaces the octal escapes used in mountinfo paths.
+func unescapeMountInfo(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// isNsfs determines if the file at the given path resides on nsfs, as any
+// mounted namespace does.
+func isNsfs(p string) bool {
+	var fs unix.Statfs_t
+	if err := unix.Statfs(p, &fs); err != nil {
+		return false
+	}
+	return fs.Type == unix.NSFS_MAGIC
+}
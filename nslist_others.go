@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package neslink
+
+import "fmt"
+
+// ListNamespaces returns every distinct network namespace that can be found on
+// the host.
+func ListNamespaces(mountdirs ...string) ([]NsInfo, error) {
+	return nil, fmt.Errorf("namespaces can not be listed on non-linux builds")
+}
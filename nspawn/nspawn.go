@@ -0,0 +1,77 @@
+package nspawn
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/willfantom/neslink"
+)
+
+const (
+	// DefaultMachinesPath is the directory in which systemd-machined keeps the
+	// runtime state of each registered machine.
+	DefaultMachinesPath string = "/run/systemd/machines"
+)
+
+func init() {
+	neslink.RegisterNsProvider("nspawn.NPMachineAt", func(d neslink.Descriptor) (neslink.NsProvider, error) {
+		var machinesdir, name string
+		if err := d.Args(&machinesdir, &name); err != nil {
+			return neslink.NsProvider{}, err
+		}
+		return NPMachineAt(machinesdir, name), nil
+	})
+}
+
+// NPMachine returns a netns provider that provides the netns path for the
+// systemd-nspawn container (or any other machine registered with
+// systemd-machined) with the given name. The netns is that of the machine's
+// leader process, as recorded in the machine's runtime state.
+func NPMachine(name string) neslink.NsProvider {
+	return NPMachineAt(DefaultMachinesPath, name)
+}
+
+// NPMachineAt returns a netns provider that provides the netns path for the
+// machine with the given name, reading machine state from the given directory.
+func NPMachineAt(machinesdir, name string) neslink.NsProvider {
+	return neslink.NPGeneric(
+		"nspawn-machine",
+		func() (neslink.Namespace, error) {
+			pid, err := leaderPid(path.Join(machinesdir, name))
+			if err != nil {
+				return neslink.Namespace(""), fmt.Errorf("failed to get leader of machine %s: %w", name, err)
+			}
+			return neslink.NPProcess(pid).Provide()
+		},
+	).WithDescriptor(neslink.NewDescriptor("nspawn.NPMachineAt", machinesdir, name))
+}
+
+// leaderPid reads the leader pid from a machined state file, which is made up
+// of KEY=value lines.
+func leaderPid(statePath string) (int, error) {
+	f, err := os.Open(statePath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if !found || key != "LEADER" {
+			continue
+		}
+		pid, err := strconv.Atoi(value)
+		if err != nil || pid <= 0 {
+			return 0, fmt.Errorf("invalid leader pid: %s", value)
+		}
+		return pid, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("machine state has no leader")
+}
@@ -3,10 +3,15 @@ package neslink
 import (
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path"
-
-	"golang.org/x/sys/unix"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 // NsProvider offers a approach to obtaining network namespace paths based on
@@ -14,10 +19,17 @@ import (
 type NsProvider struct {
 	name string
 	f    func() (Namespace, error)
+	desc Descriptor
 }
 
+const (
+	cgroupPath string = "/sys/fs/cgroup"
+)
+
 var (
-	errNoNs error = errors.New("failed to obtain netns from provider")
+	errNoNs        error = errors.New("failed to obtain netns from provider")
+	errNoProcess   error = errors.New("no process matches the provider conditions")
+	errAmbiguousNs error = errors.New("matching processes are in more than one netns")
 )
 
 // Provide determines the network namespace path based on the provider's
@@ -46,8 +58,9 @@ func NPGeneric(providerName string, function func() (Namespace, error)) NsProvid
 func NPNow() NsProvider {
 	return NsProvider{
 		name: "now",
+		desc: NewDescriptor("NPNow"),
 		f: func() (Namespace, error) {
-			return Namespace(fmt.Sprintf("/proc/%d/task/%d/ns/net", os.Getpid(), unix.Gettid())), nil
+			return backend.CurrentNs()
 		},
 	}
 }
@@ -57,6 +70,7 @@ func NPNow() NsProvider {
 func NPProcess(pid int) NsProvider {
 	return NsProvider{
 		name: "process",
+		desc: NewDescriptor("NPProcess", pid),
 		f: func() (Namespace, error) {
 			return Namespace(fmt.Sprintf("/proc/%d/ns/net", pid)), nil
 		},
@@ -68,6 +82,7 @@ func NPProcess(pid int) NsProvider {
 func NPThread(pid, tid int) NsProvider {
 	return NsProvider{
 		name: "thread",
+		desc: NewDescriptor("NPThread", pid, tid),
 		f: func() (Namespace, error) {
 			return Namespace(fmt.Sprintf("/proc/%d/task/%d/ns/net", pid, tid)), nil
 		},
@@ -79,6 +94,7 @@ func NPThread(pid, tid int) NsProvider {
 func NPName(name string) NsProvider {
 	return NsProvider{
 		name: "name",
+		desc: NewDescriptor("NPName", name),
 		f: func() (Namespace, error) {
 			return Namespace(path.Join(DefaultMountPath, name)), nil
 		},
@@ -90,6 +106,7 @@ func NPName(name string) NsProvider {
 func NPNameAt(mountdir, name string) NsProvider {
 	return NsProvider{
 		name: "name-at",
+		desc: NewDescriptor("NPNameAt", mountdir, name),
 		f: func() (Namespace, error) {
 			return Namespace(path.Join(mountdir, name)), nil
 		},
@@ -102,7 +119,288 @@ func NPPath(path string) NsProvider {
 	ns := Namespace(path)
 	return NsProvider{
 		name: "path",
+		desc: NewDescriptor("NPPath", path),
+		f: func() (Namespace, error) {
+			return ns, nil
+		},
+	}
+}
+
+// NPNetNsID returns a netns provider that provides the netns that has been
+// assigned the given netnsid by the netns of the origin provider. This is
+// useful for finding the netns referenced by the link-netnsid attribute of a
+// link. Candidate namespaces are found via ListNamespaces, with any additional
+// mount directories given also being searched.
+func NPNetNsID(origin NsProvider, nsid int, mountdirs ...string) NsProvider {
+	return NsProvider{
+		name: "netnsid",
+		desc: NewDescriptor("NPNetNsID", origin, nsid, mountdirs),
+		f: func() (Namespace, error) {
+			originNs, err := origin.Provide()
+			if err != nil {
+				return Namespace(""), errors.Join(errNoNs, err)
+			}
+			originFd, err := backend.OpenNs(originNs)
+			if err != nil {
+				return Namespace(""), err
+			}
+			defer backend.CloseNs(originFd)
+			infos, err := ListNamespaces(mountdirs...)
+			if err != nil {
+				return Namespace(""), err
+			}
+			for _, info := range infos {
+				ns, err := info.Provider.Provide()
+				if err != nil {
+					continue
+				}
+				fd, err := backend.OpenNs(ns)
+				if err != nil {
+					continue
+				}
+				id, err := backend.NetNsID(originFd, fd)
+				backend.CloseNs(fd)
+				if err == nil && id == nsid {
+					return ns, nil
+				}
+			}
+			return Namespace(""), fmt.Errorf("could not find netns with netnsid %d", nsid)
+		},
+	}
+}
+
+// NPSameAs returns a netns provider that provides a path for the same netns as
+// the one obtained from the given provider, preferring mounted namespaces and
+// processes over threads. This is useful for obtaining a path for a netns that
+// remains valid beyond the lifetime of the original path, such as that of
+// NPNow in a Do call. Candidate namespaces are found via ListNamespaces, with
+// any additional mount directories given also being searched.
+func NPSameAs(nsP NsProvider, mountdirs ...string) NsProvider {
+	return NsProvider{
+		name: "same-as",
+		desc: NewDescriptor("NPSameAs", nsP, mountdirs),
+		f: func() (Namespace, error) {
+			ns, err := nsP.Provide()
+			if err != nil {
+				return Namespace(""), errors.Join(errNoNs, err)
+			}
+			id, err := ns.ID()
+			if err != nil {
+				return Namespace(""), err
+			}
+			infos, err := ListNamespaces(mountdirs...)
+			if err != nil {
+				return Namespace(""), err
+			}
+			for _, info := range infos {
+				if info.ID == id && (len(info.Names) > 0 || len(info.Pids) > 0) {
+					return info.Provider.Provide()
+				}
+			}
+			return Namespace(""), fmt.Errorf("could not find a process or mount for netns %s", id)
+		},
+	}
+}
+
+// NPProcessName returns a netns provider that provides the netns path for the
+// processes with a command name (as in /proc/<pid>/comm) matching the given
+// regular expression. The kernel truncates command names to 15 characters, so
+// the pattern should not rely on any characters beyond that (for example, a
+// process running systemd-networkd has the name systemd-network). An error is
+// returned if no processes match, or if the matching processes are not all in
+// the same netns.
+func NPProcessName(pattern string) NsProvider {
+	return NsProvider{
+		name: "process-name",
+		desc: NewDescriptor("NPProcessName", pattern),
+		f: func() (Namespace, error) {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return Namespace(""), fmt.Errorf("failed to compile process name pattern: %w", err)
+			}
+			entries, err := os.ReadDir(procPath)
+			if err != nil {
+				return Namespace(""), fmt.Errorf("failed to read %s: %w", procPath, err)
+			}
+			pids := make([]int, 0)
+			for _, e := range entries {
+				pid, err := strconv.Atoi(e.Name())
+				if err != nil {
+					continue
+				}
+				comm, err := os.ReadFile(path.Join(procPath, e.Name(), "comm"))
+				if err != nil {
+					continue
+				}
+				if re.MatchString(strings.TrimSuffix(string(comm), "\n")) {
+					pids = append(pids, pid)
+				}
+			}
+			return pidsNs(pids, fmt.Sprintf("process name %q", pattern))
+		},
+	}
+}
+
+// NPCgroup returns a netns provider that provides the netns path for the
+// processes in the given cgroup, or any of its descendants. The cgroup path can
+// be given relative to the cgroup v2 (unified) mount at /sys/fs/cgroup (such
+// as /system.slice/foo.service) or as a full path in the cgroup filesystem.
+// Relative paths are only supported for cgroup v2, so on hosts using cgroup v1
+// the full path of the cgroup in one of the controller hierarchies (such as
+// /sys/fs/cgroup/pids/system.slice/foo.service) must be given. Descendant
+// cgroups that are removed whilst they are being read are skipped. An error is
+// returned if the cgroup has no processes, or if its processes are not all in
+// the same netns.
+func NPCgroup(cgroup string) NsProvider {
+	return NsProvider{
+		name: "cgroup",
+		desc: NewDescriptor("NPCgroup", cgroup),
+		f: func() (Namespace, error) {
+			dir := cgroup
+			if !strings.HasPrefix(dir, cgroupPath+"/") {
+				dir = path.Join(cgroupPath, cgroup)
+			}
+			pids := make([]int, 0)
+			err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+				if err != nil {
+					// descendants can be removed mid-walk
+					if p != dir && errors.Is(err, fs.ErrNotExist) {
+						return nil
+					}
+					return err
+				}
+				if d.IsDir() || d.Name() != "cgroup.procs" {
+					return nil
+				}
+				procs, err := os.ReadFile(p)
+				if err != nil {
+					if errors.Is(err, fs.ErrNotExist) {
+						return nil
+					}
+					return err
+				}
+				for _, line := range strings.Fields(string(procs)) {
+					if pid, err := strconv.Atoi(line); err == nil {
+						pids = append(pids, pid)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return Namespace(""), fmt.Errorf("failed to read processes of cgroup %s: %w", cgroup, err)
+			}
+			return pidsNs(pids, fmt.Sprintf("cgroup %s", cgroup))
+		},
+	}
+}
+
+// NPPidFile returns a netns provider that provides the netns path for the
+// process with the process ID stored in the given file. The file is read each
+// time the provider is called.
+func NPPidFile(pidfile string) NsProvider {
+	return NsProvider{
+		name: "pid-file",
+		desc: NewDescriptor("NPPidFile", pidfile),
+		f: func() (Namespace, error) {
+			content, err := os.ReadFile(pidfile)
+			if err != nil {
+				return Namespace(""), fmt.Errorf("failed to read pid file: %w", err)
+			}
+			pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+			if err != nil || pid <= 0 {
+				return Namespace(""), fmt.Errorf("pid file %s does not contain a valid pid", pidfile)
+			}
+			return pidsNs([]int{pid}, fmt.Sprintf("pid file %s", pidfile))
+		},
+	}
+}
+
+// pidsNs returns the netns path of the given processes, so long as they are
+// all in the same netns. Processes that exit before their netns is checked are
+// ignored. The description is used to give context to errors.
+func pidsNs(pids []int, description string) (Namespace, error) {
+	var found Namespace
+	foundIDs := make(map[NsID][]int)
+	for _, pid := range pids {
+		ns, _ := NPProcess(pid).Provide()
+		id, err := ns.ID()
+		if err != nil {
+			continue
+		}
+		if len(foundIDs) == 0 {
+			found = ns
+		}
+		foundIDs[id] = append(foundIDs[id], pid)
+	}
+	switch len(foundIDs) {
+	case 0:
+		return Namespace(""), fmt.Errorf("%w: %s", errNoProcess, description)
+	case 1:
+		return found, nil
+	default:
+		groups := make([]string, 0, len(foundIDs))
+		for id, pids := range foundIDs {
+			groups = append(groups, fmt.Sprintf("%s: %v", id, pids))
+		}
+		return Namespace(""), fmt.Errorf("%w: %s (%s)", errAmbiguousNs, description, strings.Join(groups, "; "))
+	}
+}
+
+// NPCached returns a netns provider that remembers the netns path obtained
+// from the given provider, along with the identity of the netns. The
+// remembered path is provided until the ttl has passed or the path no longer
+// refers to the same netns, at which point the given provider is called again.
+// A ttl of 0 means the path is only re-resolved once it goes stale. This is
+// useful for providers that are costly to call, such as those that query a
+// container runtime.
+func NPCached(nsP NsProvider, ttl time.Duration) NsProvider {
+	var (
+		mu      sync.Mutex
+		cached  Namespace
+		id      NsID
+		expires time.Time
+	)
+	return NsProvider{
+		name: "cached",
+		desc: NewDescriptor("NPCached", nsP, ttl),
+		f: func() (Namespace, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if cached != "" && (ttl == 0 || time.Now().Before(expires)) {
+				if current, err := cached.ID(); err == nil && current == id {
+					return cached, nil
+				}
+			}
+			ns, err := nsP.Provide()
+			if err != nil {
+				cached = ""
+				return Namespace(""), err
+			}
+			nsID, err := ns.ID()
+			if err != nil {
+				cached = ""
+				return Namespace(""), err
+			}
+			cached, id, expires = ns, nsID, time.Now().Add(ttl)
+			return ns, nil
+		},
+	}
+}
+
+// NPValidated returns a netns provider that checks the path obtained from the
+// given provider is that of a network namespace before providing it.
+func NPValidated(nsP NsProvider) NsProvider {
+	return NsProvider{
+		name: "validated",
+		desc: NewDescriptor("NPValidated", nsP),
 		f: func() (Namespace, error) {
+			ns, err := nsP.Provide()
+			if err != nil {
+				return Namespace(""), err
+			}
+			if err := ns.Validate(); err != nil {
+				return Namespace(""), fmt.Errorf("invalid netns from %s provider: %w", nsP.name, err)
+			}
 			return ns, nil
 		},
 	}
@@ -0,0 +1,588 @@
+package neslink
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vishvananda/netlink"
+)
+
+// Plan describes what a call to Do would do, as created by DryRun. It can be
+// printed (via String) or encoded as json. Providers that failed to resolve are
+// included in the plan with their error, and are returned together by Err.
+type Plan struct {
+	Namespace PlanNs     `json:"namespace"`
+	Steps     []PlanStep `json:"steps"`
+}
+
+// PlanNs is a netns provider along with the netns it resolved to.
+type PlanNs struct {
+	Provider string `json:"provider"`
+	Path     string `json:"path,omitempty"`
+	ID       string `json:"id,omitempty"`
+	Error    string `json:"error,omitempty"`
+	err      error
+}
+
+// PlanLink is a link provider along with the link it resolved to.
+type PlanLink struct {
+	Provider string `json:"provider"`
+	Index    int    `json:"index,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Error    string `json:"error,omitempty"`
+	err      error
+}
+
+// PlanStep is an action of a plan, with the change it would make and the
+// providers it was given.
+type PlanStep struct {
+	Index      int        `json:"index"`
+	Action     string     `json:"action"`
+	Kind       string     `json:"kind,omitempty"`
+	Change     string     `json:"change"`
+	Links      []PlanLink `json:"links,omitempty"`
+	Namespaces []PlanNs   `json:"namespaces,omitempty"`
+}
+
+// changes are the descriptions of the changes made by the built-in kinds of
+// action, given the arguments of the action as strings.
+var changes = map[string]string{
+	"LANewBridge":        "create bridge %[1]s",
+	"LANewVeth":          "create veth %[1]s with peer %[2]s",
+	"LANewVethPeerNs":    "create veth %[1]s with peer %[2]s in netns %[3]s",
+	"LANewDummy":         "create dummy %[1]s",
+	"LANewGRETap":        "create gretap %[1]s from %[2]s to %[3]s",
+	"LANewTuntap":        "create tuntap %[1]s as %[2]s",
+	"LANewWireguard":     "create wireguard %[1]s",
+	"LANewVxlan":         "create vxlan %[1]s with vni %[4]s and port %[5]s, from %[2]s to group %[3]s",
+	"LANewGRE":           "create gre %[1]s %[2]s",
+	"LANewIPIP":          "create ipip %[1]s %[2]s",
+	"LANewSIT":           "create sit %[1]s %[2]s",
+	"LANewIP6Tnl":        "create ip6tnl %[1]s %[2]s",
+	"LANewGeneve":        "create geneve %[1]s %[2]s",
+	"LADelete":           "delete %[1]s",
+	"LASetName":          "rename %[1]s to %[2]s",
+	"LASetAlias":         "set the alias of %[1]s to %[2]s",
+	"LASetHw":            "set the hardware address of %[1]s to %[2]s",
+	"LASetMTU":           "set the mtu of %[1]s to %[2]s",
+	"LASet":              "set %[2]s on %[1]s",
+	"LASetUp":            "set %[1]s up",
+	"LASetDown":          "set %[1]s down",
+	"LASetPromiscOn":     "enable promiscuous mode on %[1]s",
+	"LASetPromiscOff":    "disable promiscuous mode on %[1]s",
+	"LAAddAddr":          "add address %[2]s to %[1]s",
+	"LADelAddr":          "remove address %[2]s from %[1]s",
+	"LASetMaster":        "set the master of %[1]s to %[2]s",
+	"LASetNoMaster":      "remove the master of %[1]s",
+	"LAAddRoute":         "add a route to %[2]s via %[3]s on %[1]s",
+	"LADelRoute":         "remove the route to %[2]s via %[3]s on %[1]s",
+	"LAAddAddrConfig":    "add address %[2]s to %[1]s",
+	"LAReplaceAddr":      "add or replace address %[2]s on %[1]s",
+	"LAFlushAddrs":       "remove all addresses of family %[2]s from %[1]s",
+	"LAGetAddrs":         "get the addresses of family %[2]s of %[1]s",
+	"LAWaitExists":       "wait for %[1]s to exist (timeout %[2]s)",
+	"LAWaitOperUp":       "wait for %[1]s to be operationally up (timeout %[2]s)",
+	"LAWaitCarrier":      "wait for carrier on %[1]s (timeout %[2]s)",
+	"LAWaitAddr":         "wait for address %[2]s on %[1]s to be usable (timeout %[3]s)",
+	"LAEnsureBridge":     "create bridge %[1]s if it does not exist",
+	"LAEnsureDummy":      "create dummy %[1]s if it does not exist",
+	"LAEnsureVeth":       "create veth %[1]s with peer %[2]s if it does not exist",
+	"LAEnsureAddr":       "add address %[2]s to %[1]s if it is not present",
+	"LAEnsureAddrConfig": "add address %[2]s to %[1]s if it is not present",
+	"LAEnsureRoute":      "add a route to %[2]s via %[3]s on %[1]s if it is not present",
+	"NANewNsAt":          "create netns %[2]s in %[1]s and move into it",
+	"NANewNs":            "create netns %[1]s and move into it",
+	"NAEnsureNsAt":       "create netns %[2]s in %[1]s if it does not exist and move into it",
+	"NAEnsureNs":         "create netns %[1]s if it does not exist and move into it",
+	"NASetLinkNs":        "move %[1]s to netns %[2]s",
+	"NALinks":            "list links",
+	"NAAddrs":            "list addresses of family %[1]s",
+	"NADeleteNamedAt":    "delete netns %[2]s from %[1]s",
+	"NADeleteNamed":      "delete netns %[1]s",
+	"NAGetLink":          "get %[1]s",
+	"NAGetNetNsID":       "get the netnsid of netns %[1]s",
+	"NASetNetNsID":       "assign netnsid %[2]s to netns %[1]s",
+	"NAVethPeer":         "find the peer of %[1]s",
+	"NAAddFou":           "add fou port %[1]s",
+	"NADelFou":           "remove fou port %[1]s",
+	"NAWaitRoute":        "wait for a route to %[1]s (timeout %[2]s)",
+}
+
+// DryRun creates a plan of what Do would do with the given provider and
+// actions, without performing any of the actions. The netns provider is
+// resolved, as is every provider given to an action (in the target netns), so
+// the plan shows the concrete netns and links the actions would use. Since no
+// actions are performed, providers are resolved against the netns as it is
+// before any action, so a link created by an earlier action (for example) will
+// be shown as not found. Such failures are recorded in the plan rather than
+// returned, and can be checked via Plan.Err. An error is only returned if the
+// target netns can not be resolved or entered. Actions that have no descriptor
+// (see Descriptor), such as those via LAGeneric, are listed without details of
+// their change.
+func DryRun(nsP NsProvider, actions ...Action) (Plan, error) {
+	ns, err := nsP.Provide()
+	if err != nil {
+		return Plan{}, fmt.Errorf("failed to get target netns: %w", err)
+	}
+	plan := Plan{
+		Namespace: PlanNs{Provider: renderProvider(nsP.name, nsP.desc), Path: ns.String()},
+		Steps:     make([]PlanStep, 0, len(actions)),
+	}
+	if id, err := backend.IdentifyNs(ns); err == nil {
+		plan.Namespace.ID = id.String()
+	}
+	err = Do(NPPath(ns.String()), NAGeneric("dry-run", func() error {
+		for idx, action := range actions {
+			plan.Steps = append(plan.Steps, planStep(idx, action))
+		}
+		return nil
+	}))
+	if err != nil {
+		return Plan{}, err
+	}
+	return plan, nil
+}
+
+// Err returns the errors of the providers in the plan that failed to resolve,
+// joined, or nil if every provider resolved.
+func (p Plan) Err() error {
+	var errs []error
+	for _, step := range p.Steps {
+		for _, ns := range step.Namespaces {
+			if ns.Error != "" {
+				errs = append(errs, fmt.Errorf("action %d (%s): netns %s: %w", step.Index+1, step.Action, ns.Provider, planErr(ns.err, ns.Error)))
+			}
+		}
+		for _, l := range step.Links {
+			if l.Error != "" {
+				errs = append(errs, fmt.Errorf("action %d (%s): link %s: %w", step.Index+1, step.Action, l.Provider, planErr(l.err, l.Error)))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// planErr returns the error of a provider in a plan, which is only recorded as
+// a message if the plan was decoded from json.
+func planErr(err error, msg string) error {
+	if err != nil {
+		return err
+	}
+	return errors.New(msg)
+}
+
+// String returns the plan in a printable form, with a line per action, each
+// followed by the providers given to it.
+func (p Plan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "netns %s\n", p.Namespace)
+	for _, step := range p.Steps {
+		fmt.Fprintf(&b, "%d. %s: %s\n", step.Index+1, step.Action, step.Change)
+		for _, ns := range step.Namespaces {
+			fmt.Fprintf(&b, "     netns %s\n", ns)
+		}
+		for _, l := range step.Links {
+			fmt.Fprintf(&b, "     link %s\n", l)
+		}
+	}
+	return b.String()
+}
+
+// String returns the provider along with the netns it resolved to.
+func (pn PlanNs) String() string {
+	if pn.Error != "" {
+		return fmt.Sprintf("%s: error: %s", pn.Provider, oneLine(pn.Error))
+	}
+	if pn.ID != "" {
+		return fmt.Sprintf("%s = %s (%s)", pn.Provider, pn.Path, pn.ID)
+	}
+	return fmt.Sprintf("%s = %s", pn.Provider, pn.Path)
+}
+
+// String returns the provider along with the link it resolved to.
+func (pl PlanLink) String() string {
+	if pl.Error != "" {
+		return fmt.Sprintf("%s: error: %s", pl.Provider, oneLine(pl.Error))
+	}
+	return fmt.Sprintf("%s = %s (index %d, %s)", pl.Provider, pl.Name, pl.Index, pl.Type)
+}
+
+// planStep creates the plan of a single action, resolving the providers it was
+// given. This must be called in the target netns.
+func planStep(idx int, action Action) PlanStep {
+	d := action.descriptor()
+	step := PlanStep{
+		Index:  idx,
+		Action: action.name(),
+		Kind:   d.Kind,
+	}
+	args := make([]any, len(d.args))
+	for i, arg := range d.args {
+		switch v := arg.(type) {
+		case LinkProvider:
+			pl := planLink(v)
+			step.Links = append(step.Links, pl)
+			args[i] = pl.Provider
+			if pl.Error == "" {
+				args[i] = pl.Name
+			}
+		case NsProvider:
+			pn := planNs(v)
+			step.Namespaces = append(step.Namespaces, pn)
+			args[i] = pn.Provider
+			if pn.Error == "" {
+				args[i] = pn.Path
+			}
+		default:
+			for _, lp := range nestedLinkProviders(reflect.ValueOf(arg)) {
+				step.Links = append(step.Links, planLink(lp))
+			}
+			args[i] = renderValue(arg)
+		}
+	}
+	switch change, ok := changes[d.Kind]; {
+	case ok:
+		step.Change = fmt.Sprintf(change, args...)
+	case d.Kind != "":
+		step.Change = renderCall(d.Kind, d.args)
+	default:
+		step.Change = "unknown (the action has no descriptor)"
+	}
+	return step
+}
+
+// planNs resolves the given netns provider.
+func planNs(nsP NsProvider) PlanNs {
+	pn := PlanNs{Provider: renderProvider(nsP.name, nsP.desc)}
+	ns, err := nsP.Provide()
+	if err != nil {
+		pn.Error, pn.err = err.Error(), err
+		return pn
+	}
+	pn.Path = ns.String()
+	if id, err := backend.IdentifyNs(ns); err == nil {
+		pn.ID = id.String()
+	}
+	return pn
+}
+
+// planLink resolves the given link provider.
+func planLink(lp LinkProvider) PlanLink {
+	pl := PlanLink{Provider: renderProvider(lp.name, lp.desc)}
+	l, err := lp.Provide()
+	if err != nil {
+		pl.Error, pl.err = err.Error(), err
+		return pl
+	}
+	pl.Index = l.Attrs().Index
+	pl.Name = l.Attrs().Name
+	pl.Type = l.Type()
+	return pl
+}
+
+// nestedLinkProviders finds the link providers within the exported fields of
+// the given value, such as the underlay of a TunnelConfig.
+func nestedLinkProviders(v reflect.Value) []LinkProvider {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return nestedLinkProviders(v.Elem())
+	case reflect.Struct:
+		if lp, ok := v.Interface().(LinkProvider); ok {
+			return []LinkProvider{lp}
+		}
+		lps := []LinkProvider{}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				lps = append(lps, nestedLinkProviders(v.Field(i))...)
+			}
+		}
+		return lps
+	}
+	return nil
+}
+
+// renderProvider renders a provider as the call to the constructor that made
+// it (e.g. LPName("eth0")), or by its name if it has no descriptor.
+func renderProvider(name string, d Descriptor) string {
+	if d.Kind == "" {
+		return "<" + name + ">"
+	}
+	return renderCall(d.Kind, d.args)
+}
+
+// renderCall renders a call to the constructor of the given kind.
+func renderCall(kind string, args []any) string {
+	rendered := make([]string, len(args))
+	for idx, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			rendered[idx] = strconv.Quote(v)
+		default:
+			rendered[idx] = renderValue(v)
+		}
+	}
+	return kind + "(" + strings.Join(rendered, ", ") + ")"
+}
+
+// renderValue renders an argument of a constructor. The configs of the
+// built-in actions are rendered as a description of their fields, and json is
+// used for anything else other than simple values.
+func renderValue(arg any) string {
+	switch v := arg.(type) {
+	case LinkProvider:
+		return renderProvider(v.name, v.desc)
+	case NsProvider:
+		return renderProvider(v.name, v.desc)
+	case LinksProvider:
+		return renderProvider(v.name, v.desc)
+	case string:
+		if v == "" {
+			return `""`
+		}
+		return v
+	case time.Duration:
+		return v.String()
+	case int, uint32, uint16, uint8, bool:
+		return fmt.Sprint(v)
+	case FouConfig:
+		return renderFou(v)
+	case TunnelConfig:
+		return renderTunnel(v)
+	case GREConfig:
+		return renderGRE(v)
+	case GeneveConfig:
+		return renderGeneve(v)
+	case AddrConfig:
+		return renderAddr(v)
+	case TuntapConfig:
+		return renderTuntap(v)
+	case LinkSettings:
+		return renderSettings(v)
+	case VethEnd:
+		return renderVethEnd(v)
+	}
+	b, err := json.Marshal(arg)
+	if err != nil {
+		return fmt.Sprintf("%+v", arg)
+	}
+	return string(b)
+}
+
+// withDetails appends the given details (if any) to a rendered value.
+func withDetails(value string, details []string) string {
+	if len(details) == 0 {
+		return value
+	}
+	return value + " (" + strings.Join(details, ", ") + ")"
+}
+
+// renderIP renders an optional ip address.
+func renderIP(ip net.IP) string {
+	if ip == nil {
+		return "any"
+	}
+	return ip.String()
+}
+
+// renderFou renders a fou config as its port, encapsulation and family.
+func renderFou(fc FouConfig) string {
+	encap := fmt.Sprintf("fou for protocol %d", fc.Protocol)
+	if fc.GUE {
+		encap = "gue"
+	}
+	family := "ipv4"
+	if fc.IPv6 {
+		family = "ipv6"
+	}
+	return fmt.Sprintf("%d (%s over %s)", fc.Port, encap, family)
+}
+
+// renderTunnel renders a tunnel config as its endpoints, followed by any other
+// options that are set.
+func renderTunnel(tc TunnelConfig) string {
+	tunnel := fmt.Sprintf("from %s to %s", renderIP(tc.Local), renderIP(tc.Remote))
+	return withDetails(tunnel, tunnelDetails(tc))
+}
+
+// tunnelDetails lists the options of a tunnel config other than its endpoints.
+func tunnelDetails(tc TunnelConfig) []string {
+	details := []string{}
+	if tc.Underlay != nil {
+		details = append(details, "via "+renderValue(*tc.Underlay))
+	}
+	if tc.TTL != 0 {
+		details = append(details, fmt.Sprintf("ttl %d", tc.TTL))
+	}
+	if tc.TOS != 0 {
+		details = append(details, fmt.Sprintf("tos %d", tc.TOS))
+	}
+	if tc.NoPMTUDisc {
+		details = append(details, "no pmtu discovery")
+	}
+	if tc.Encap != nil {
+		encap := "fou"
+		if tc.Encap.Type == netlink.GUE {
+			encap = "gue"
+		}
+		details = append(details, fmt.Sprintf("%s encapsulation to port %d", encap, tc.Encap.Dport))
+	}
+	return details
+}
+
+// renderGRE renders a gre config as a tunnel config along with its keys.
+func renderGRE(gc GREConfig) string {
+	tunnel := fmt.Sprintf("from %s to %s", renderIP(gc.Local), renderIP(gc.Remote))
+	details := tunnelDetails(gc.TunnelConfig)
+	if gc.IKey != 0 {
+		details = append(details, fmt.Sprintf("input key %d", gc.IKey))
+	}
+	if gc.OKey != 0 {
+		details = append(details, fmt.Sprintf("output key %d", gc.OKey))
+	}
+	return withDetails(tunnel, details)
+}
+
+// renderGeneve renders a geneve config as its vni, remote and port, followed by
+// any other options that are set.
+func renderGeneve(gc GeneveConfig) string {
+	port := gc.Port
+	if port == 0 {
+		port = 6081
+	}
+	geneve := fmt.Sprintf("with vni %d to %s on port %d", gc.VNI, renderIP(gc.Remote), port)
+	return withDetails(geneve, tunnelDetails(gc.TunnelConfig))
+}
+
+// renderAddr renders an address config as its cidr, followed by any other
+// options that are set.
+func renderAddr(ac AddrConfig) string {
+	details := []string{}
+	if ac.Peer != "" {
+		details = append(details, "peer "+ac.Peer)
+	}
+	if ac.Broadcast != "" {
+		details = append(details, "broadcast "+ac.Broadcast)
+	}
+	if ac.Label != "" {
+		details = append(details, "label "+ac.Label)
+	}
+	if ac.Scope != nil {
+		details = append(details, "scope "+ac.Scope.String())
+	}
+	if ac.ValidLft != 0 {
+		details = append(details, "valid for "+ac.ValidLft.String())
+	}
+	if ac.PreferredLft != 0 {
+		details = append(details, "preferred for "+ac.PreferredLft.String())
+	}
+	if ac.NoDAD {
+		details = append(details, "no dad")
+	}
+	if ac.NoPrefixRoute {
+		details = append(details, "no prefix route")
+	}
+	if ac.MngTmpAddr {
+		details = append(details, "temporary addresses")
+	}
+	if ac.WaitDAD != 0 {
+		details = append(details, "wait for dad up to "+ac.WaitDAD.String())
+	}
+	return withDetails(ac.CIDR, details)
+}
+
+// renderTuntap renders a tuntap config as its mode, followed by any other
+// options that are set.
+func renderTuntap(tc TuntapConfig) string {
+	details := []string{}
+	if tc.MultiQueue {
+		details = append(details, fmt.Sprintf("%d queues", max(tc.Queues, 1)))
+	}
+	if tc.Persist {
+		details = append(details, "persistent")
+	}
+	if tc.VnetHdr {
+		details = append(details, "vnet header")
+	}
+	if tc.PacketInfo {
+		details = append(details, "packet info")
+	}
+	if tc.Owner != 0 {
+		details = append(details, fmt.Sprintf("owner %d", tc.Owner))
+	}
+	if tc.Group != 0 {
+		details = append(details, fmt.Sprintf("group %d", tc.Group))
+	}
+	return withDetails(tc.Mode.String(), details)
+}
+
+// renderSettings renders the link settings that are set.
+func renderSettings(ls LinkSettings) string {
+	settings := []string{}
+	addInt := func(name string, v *int) {
+		if v != nil {
+			settings = append(settings, fmt.Sprintf("%s %d", name, *v))
+		}
+	}
+	addBool := func(name string, v *bool) {
+		if v != nil {
+			state := "off"
+			if *v {
+				state = "on"
+			}
+			settings = append(settings, name+" "+state)
+		}
+	}
+	addInt("mtu", ls.MTU)
+	addInt("txqlen", ls.TxQLen)
+	addInt("group", ls.Group)
+	addInt("gso max size", ls.GSOMaxSize)
+	addInt("gso max segs", ls.GSOMaxSegs)
+	addInt("gro max size", ls.GROMaxSize)
+	addBool("multicast", ls.Multicast)
+	addBool("allmulticast", ls.AllMulticast)
+	addBool("arp", ls.ARP)
+	if len(ls.AddAltNames) > 0 {
+		settings = append(settings, "add altnames "+strings.Join(ls.AddAltNames, " "))
+	}
+	if len(ls.DelAltNames) > 0 {
+		settings = append(settings, "remove altnames "+strings.Join(ls.DelAltNames, " "))
+	}
+	if len(settings) == 0 {
+		return "nothing"
+	}
+	return strings.Join(settings, ", ")
+}
+
+// renderVethEnd renders a veth end as its name, followed by any other options
+// that are set.
+func renderVethEnd(ve VethEnd) string {
+	details := []string{}
+	if ve.HardwareAddr != "" {
+		details = append(details, "hardware address "+ve.HardwareAddr)
+	}
+	if ve.MTU != 0 {
+		details = append(details, fmt.Sprintf("mtu %d", ve.MTU))
+	}
+	if len(ve.Addrs) > 0 {
+		details = append(details, "addresses "+strings.Join(ve.Addrs, " "))
+	}
+	if ve.Up {
+		details = append(details, "up")
+	}
+	return withDetails(ve.Name, details)
+}
+
+// oneLine joins the lines of a (possibly joined) error message.
+func oneLine(msg string) string {
+	return strings.ReplaceAll(msg, "\n", ": ")
+}
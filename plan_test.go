@@ -0,0 +1,122 @@
+package neslink_test
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/willfantom/neslink"
+)
+
+func TestDryRun(t *testing.T) {
+	missingPidFile := filepath.Join(t.TempDir(), "missing.pid")
+	red := neslink.NPNameAt(fakeMountDir, "red")
+	tests := []struct {
+		name    string
+		nsP     neslink.NsProvider
+		actions []neslink.Action
+		want    []string
+		errs    []error
+		wantErr bool
+	}{
+		{
+			name: "resolved",
+			nsP:  red,
+			actions: []neslink.Action{
+				neslink.LASetMTU(neslink.LPName("br0"), 9000),
+				neslink.NASetLinkNs(neslink.LPName("br0"), neslink.NPNameAt(fakeMountDir, "blue")),
+			},
+			want: []string{
+				`netns NPNameAt("/run/netns", "red") = /run/netns/red (0:net:[2])`,
+				`1. set-mtu: set the mtu of br0 to 9000`,
+				`     link LPName("br0") = br0 (index 2, bridge)`,
+				`2. set-link-ns: move br0 to netns /run/netns/blue`,
+				`     netns NPNameAt("/run/netns", "blue") = /run/netns/blue`,
+			},
+		},
+		{
+			name: "missing link",
+			nsP:  red,
+			actions: []neslink.Action{
+				neslink.LANewBridge("br1"),
+				neslink.LASetUp(neslink.LPName("br1")),
+			},
+			want: []string{
+				`1. new-bridge: create bridge br1`,
+				`2. set-state-up: set LPName("br1") up`,
+				`     link LPName("br1"): error: `,
+			},
+			errs: []error{neslink.ErrLinkNotFound},
+		},
+		{
+			name: "unresolved netns",
+			nsP:  red,
+			actions: []neslink.Action{
+				neslink.NASetLinkNs(neslink.LPName("br0"), neslink.NPPidFile(missingPidFile)),
+				neslink.NASetLinkNs(neslink.LPName("missing"), neslink.NPNameAt(fakeMountDir, "blue")),
+			},
+			want: []string{
+				`1. set-link-ns: move br0 to netns NPPidFile(`,
+				`     netns NPPidFile("` + missingPidFile + `"): error: `,
+				`2. set-link-ns: move LPName("missing") to netns /run/netns/blue`,
+			},
+			errs: []error{fs.ErrNotExist, neslink.ErrLinkNotFound},
+		},
+		{
+			name: "no descriptor",
+			nsP:  neslink.NPNow(),
+			actions: []neslink.Action{
+				neslink.NAGeneric("custom", func() error { return nil }),
+			},
+			want: []string{`1. custom: unknown (the action has no descriptor)`},
+		},
+		{
+			name:    "missing target",
+			nsP:     neslink.NPNameAt(fakeMountDir, "blue"),
+			actions: []neslink.Action{neslink.LASetUp(neslink.LPName("br0"))},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := useFake(t)
+			if err := neslink.Do(neslink.NPNow(), neslink.NANewNsAt(fakeMountDir, "red"), neslink.LANewBridge("br0")); err != nil {
+				t.Fatalf("failed to set up: %v", err)
+			}
+			plan, err := neslink.DryRun(tt.nsP, tt.actions...)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			out := plan.String()
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("expected plan to contain %q, got:\n%s", want, out)
+				}
+			}
+			err = plan.Err()
+			if len(tt.errs) == 0 && err != nil {
+				t.Errorf("unexpected plan error: %v", err)
+			}
+			for _, want := range tt.errs {
+				if !errors.Is(err, want) {
+					t.Errorf("expected plan error matching %v, got %v", want, err)
+				}
+			}
+			// nothing is performed by a dry run
+			if links, _ := b.Links(b.Root()); len(links) != 1 {
+				t.Errorf("expected only the loopback link in the root netns, got %d links", len(links))
+			}
+			if _, err := b.Links(neslink.Namespace(fakeMountDir + "/blue")); err == nil {
+				t.Error("expected the blue netns not to exist")
+			}
+		})
+	}
+}
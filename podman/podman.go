@@ -0,0 +1,125 @@
+package podman
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/willfantom/neslink"
+)
+
+const (
+	// DefaultSocket is the default path of the rootful podman api socket.
+	DefaultSocket string = "/run/podman/podman.sock"
+
+	// apiVersion is the version of the libpod api used for requests.
+	apiVersion string = "v4.0.0"
+)
+
+var (
+	// clients holds an http client per podman api socket, so that connections
+	// to each socket are reused across calls to Provide.
+	clients   map[string]*http.Client = make(map[string]*http.Client)
+	clientsMu sync.Mutex
+)
+
+func init() {
+	neslink.RegisterNsProvider("podman.NPContainer", func(d neslink.Descriptor) (neslink.NsProvider, error) {
+		var socket, container string
+		if err := d.Args(&socket, &container); err != nil {
+			return neslink.NsProvider{}, err
+		}
+		return NPContainer(context.Background(), socket, container), nil
+	})
+}
+
+// containerInspect is the subset of the libpod container inspect response that
+// is used to find the netns of a container.
+type containerInspect struct {
+	ID    string `json:"Id"`
+	State struct {
+		Running bool `json:"Running"`
+		Pid     int  `json:"Pid"`
+	} `json:"State"`
+	NetworkSettings struct {
+		SandboxKey string `json:"SandboxKey"`
+	} `json:"NetworkSettings"`
+}
+
+// NPContainer returns a netns provider that provides the netns path for the
+// podman container with the given name or id, via the podman api listening on
+// the given unix socket (such as DefaultSocket). The netns podman has mounted
+// for the container (usually /run/netns/netns-*) is preferred, falling back to
+// the netns of the container's process (for example with rootless podman). The
+// context is not part of the provider's descriptor, so a provider built from
+// the descriptor uses context.Background.
+func NPContainer(ctx context.Context, socket, container string) neslink.NsProvider {
+	return neslink.NPGeneric(
+		"podman-container",
+		func() (neslink.Namespace, error) {
+			c, err := inspect(ctx, socket, container)
+			if err != nil {
+				return neslink.Namespace(""), err
+			}
+			if !c.State.Running || c.State.Pid == 0 {
+				return neslink.Namespace(""), fmt.Errorf("podman container is not running: %s", container)
+			}
+			if c.NetworkSettings.SandboxKey != "" {
+				return neslink.Namespace(c.NetworkSettings.SandboxKey), nil
+			}
+			return neslink.NPProcess(c.State.Pid).Provide()
+		},
+	).WithDescriptor(neslink.NewDescriptor("podman.NPContainer", socket, container))
+}
+
+// socketClient returns the http client used for requests to the podman api
+// listening on the given unix socket, creating it if required.
+func socketClient(socket string) *http.Client {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if client, ok := clients[socket]; ok {
+		return client
+	}
+	dialer := &net.Dialer{}
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+	clients[socket] = client
+	return client
+}
+
+// inspect requests the inspect information for the given container from the
+// podman api.
+func inspect(ctx context.Context, socket, container string) (*containerInspect, error) {
+	reqURL := fmt.Sprintf("http://podman/%s/libpod/containers/%s/json", apiVersion, url.PathEscape(container))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create podman api request: %w", err)
+	}
+	resp, err := socketClient(socket).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get container infomation:  %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return nil, fmt.Errorf("failed to get container infomation: podman api returned %s: %s", resp.Status, strings.TrimSpace(apiErr.Message))
+	}
+	var c containerInspect
+	if err := json.NewDecoder(resp.Body).Decode(&c); err != nil {
+		return nil, fmt.Errorf("failed to decode container infomation: %w", err)
+	}
+	return &c, nil
+}
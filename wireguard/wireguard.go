@@ -0,0 +1,308 @@
+package wireguard
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/willfantom/neslink"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+const (
+	// DefaultListenPort is the listen port used by Connect when none is given.
+	DefaultListenPort int = 51820
+)
+
+// Peer describes a wireguard peer. The endpoint should be given in host:port
+// form, and may be left empty for peers that only connect in. Allowed IPs
+// should be given in CIDR notation. A keepalive of 0 disables persistent
+// keepalives.
+type Peer struct {
+	PublicKey    wgtypes.Key
+	PresharedKey *wgtypes.Key
+	Endpoint     string
+	AllowedIPs   []string
+	Keepalive    time.Duration
+}
+
+// config converts the peer into the form used by wgctrl.
+func (p Peer) config() (wgtypes.PeerConfig, error) {
+	pc := wgtypes.PeerConfig{
+		PublicKey:                   p.PublicKey,
+		PresharedKey:                p.PresharedKey,
+		PersistentKeepaliveInterval: &p.Keepalive,
+		ReplaceAllowedIPs:           true,
+	}
+	if p.Endpoint != "" {
+		endpoint, err := net.ResolveUDPAddr("udp", p.Endpoint)
+		if err != nil {
+			return pc, fmt.Errorf("failed to resolve peer endpoint: %w", err)
+		}
+		pc.Endpoint = endpoint
+	}
+	for _, cidr := range p.AllowedIPs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return pc, fmt.Errorf("failed to parse peer allowed ip: %w", err)
+		}
+		pc.AllowedIPs = append(pc.AllowedIPs, *ipNet)
+	}
+	return pc, nil
+}
+
+// The actions that are given keys, LAConfigure, LASetPrivateKey and LAAddPeer,
+// have no descriptor so that secrets are not written to logs. LAGetDevice has
+// none either, as a device built from a descriptor would be discarded rather
+// than returned. The rest are registered here.
+func init() {
+	neslink.RegisterAction("wireguard.LASetListenPort", func(d neslink.Descriptor) (neslink.Action, error) {
+		var provider neslink.LinkProvider
+		var port int
+		if err := d.Args(&provider, &port); err != nil {
+			return nil, err
+		}
+		return LASetListenPort(provider, port), nil
+	})
+	neslink.RegisterAction("wireguard.LASetFwmark", func(d neslink.Descriptor) (neslink.Action, error) {
+		var provider neslink.LinkProvider
+		var mark int
+		if err := d.Args(&provider, &mark); err != nil {
+			return nil, err
+		}
+		return LASetFwmark(provider, mark), nil
+	})
+	neslink.RegisterAction("wireguard.LARemovePeer", func(d neslink.Descriptor) (neslink.Action, error) {
+		var provider neslink.LinkProvider
+		var publicKey string
+		if err := d.Args(&provider, &publicKey); err != nil {
+			return nil, err
+		}
+		key, err := wgtypes.ParseKey(publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key: %w", err)
+		}
+		return LARemovePeer(provider, key), nil
+	})
+}
+
+// LAConfigure applies the given wgctrl configuration to the wireguard link
+// given by the provider. Only the fields that are set are changed.
+func LAConfigure(provider neslink.LinkProvider, config wgtypes.Config) neslink.LinkAction {
+	return neslink.LAGeneric("wireguard-configure", provider, func() error {
+		return configure(provider, config)
+	})
+}
+
+// LASetPrivateKey sets the private key of the wireguard link given by the
+// provider.
+func LASetPrivateKey(provider neslink.LinkProvider, key wgtypes.Key) neslink.LinkAction {
+	return neslink.LAGeneric("wireguard-set-private-key", provider, func() error {
+		return configure(provider, wgtypes.Config{PrivateKey: &key})
+	})
+}
+
+// LASetListenPort sets the listen port of the wireguard link given by the
+// provider.
+func LASetListenPort(provider neslink.LinkProvider, port int) neslink.LinkAction {
+	return neslink.LAGeneric("wireguard-set-listen-port", provider, func() error {
+		return configure(provider, wgtypes.Config{ListenPort: &port})
+	}).WithDescriptor(neslink.NewDescriptor("wireguard.LASetListenPort", provider, port))
+}
+
+// LASetFwmark sets the firewall mark applied to packets sent by the wireguard
+// link given by the provider. A mark of 0 disables this.
+func LASetFwmark(provider neslink.LinkProvider, mark int) neslink.LinkAction {
+	return neslink.LAGeneric("wireguard-set-fwmark", provider, func() error {
+		return configure(provider, wgtypes.Config{FirewallMark: &mark})
+	}).WithDescriptor(neslink.NewDescriptor("wireguard.LASetFwmark", provider, mark))
+}
+
+// LAAddPeer adds the given peer to the wireguard link given by the provider. If
+// a peer with the same public key already exists, it is updated instead.
+func LAAddPeer(provider neslink.LinkProvider, peer Peer) neslink.LinkAction {
+	return neslink.LAGeneric("wireguard-add-peer", provider, func() error {
+		pc, err := peer.config()
+		if err != nil {
+			return err
+		}
+		return configure(provider, wgtypes.Config{Peers: []wgtypes.PeerConfig{pc}})
+	})
+}
+
+// LARemovePeer removes the peer with the given public key from the wireguard
+// link given by the provider.
+func LARemovePeer(provider neslink.LinkProvider, publicKey wgtypes.Key) neslink.LinkAction {
+	return neslink.LAGeneric("wireguard-remove-peer", provider, func() error {
+		return configure(provider, wgtypes.Config{Peers: []wgtypes.PeerConfig{{PublicKey: publicKey, Remove: true}}})
+	}).WithDescriptor(neslink.NewDescriptor("wireguard.LARemovePeer", provider, publicKey.String()))
+}
+
+// LAGetDevice gets the current configuration and state of the wireguard link
+// given by the provider, storing it in the given device parameter.
+func LAGetDevice(provider neslink.LinkProvider, device *wgtypes.Device) neslink.LinkAction {
+	return neslink.LAGeneric("wireguard-get-device", provider, func() error {
+		l, err := provider.Provide()
+		if err != nil {
+			return err
+		}
+		client, err := wgctrl.New()
+		if err != nil {
+			return fmt.Errorf("failed to create wireguard client: %w", err)
+		}
+		defer client.Close()
+		d, err := client.Device(l.Attrs().Name)
+		if err != nil {
+			return fmt.Errorf("failed to get wireguard device: %w", err)
+		}
+		*device = *d
+		return nil
+	})
+}
+
+// configure applies the given configuration to the link given by the provider.
+// The wgctrl client is created here, as its netlink socket is bound to the
+// netns of the thread that creates it.
+func configure(provider neslink.LinkProvider, config wgtypes.Config) error {
+	l, err := provider.Provide()
+	if err != nil {
+		return err
+	}
+	client, err := wgctrl.New()
+	if err != nil {
+		return fmt.Errorf("failed to create wireguard client: %w", err)
+	}
+	defer client.Close()
+	if err := client.ConfigureDevice(l.Attrs().Name, config); err != nil {
+		return fmt.Errorf("failed to configure wireguard device: %w", err)
+	}
+	return nil
+}
+
+// Endpoint describes one side of a wireguard tunnel created by Connect. A
+// wireguard link with the given name is created in the given netns, with the
+// given tunnel addresses (in CIDR notation). The other side reaches this one
+// via the first global address of the underlay link of the given family
+// (netlink.FAMILY_V4 or netlink.FAMILY_V6), where a family of 0 is IPv4.
+// Traffic for the AllowedIPs is routed to this side by the other, which
+// defaults to host prefixes of the tunnel addresses if none are given.
+type Endpoint struct {
+	Ns         neslink.NsProvider
+	Name       string
+	Addrs      []string
+	Underlay   neslink.LinkProvider
+	Family     int
+	ListenPort int
+	AllowedIPs []string
+}
+
+// Connect creates a wireguard tunnel between two namespaces. A key pair is
+// generated for each side, and each side is configured with the other as a
+// peer, using the other's underlay address as the peer endpoint. Both links
+// are set up once configured. The public keys of both sides are returned.
+func Connect(a, b Endpoint, keepalive time.Duration) (wgtypes.Key, wgtypes.Key, error) {
+	aKey, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		return wgtypes.Key{}, wgtypes.Key{}, fmt.Errorf("failed to generate private key: %w", err)
+	}
+	bKey, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		return wgtypes.Key{}, wgtypes.Key{}, fmt.Errorf("failed to generate private key: %w", err)
+	}
+	aPeer, err := a.peer(aKey.PublicKey(), keepalive)
+	if err != nil {
+		return wgtypes.Key{}, wgtypes.Key{}, err
+	}
+	bPeer, err := b.peer(bKey.PublicKey(), keepalive)
+	if err != nil {
+		return wgtypes.Key{}, wgtypes.Key{}, err
+	}
+	if err := a.setup(aKey, bPeer); err != nil {
+		return wgtypes.Key{}, wgtypes.Key{}, err
+	}
+	if err := b.setup(bKey, aPeer); err != nil {
+		return wgtypes.Key{}, wgtypes.Key{}, errors.Join(err, neslink.Do(a.Ns, neslink.LADelete(neslink.LPName(a.Name))))
+	}
+	return aKey.PublicKey(), bKey.PublicKey(), nil
+}
+
+// listenPort returns the listen port of the endpoint, or the default if none is
+// set.
+func (e Endpoint) listenPort() int {
+	if e.ListenPort == 0 {
+		return DefaultListenPort
+	}
+	return e.ListenPort
+}
+
+// peer creates the peer that the other side of a tunnel should use to reach
+// this endpoint, resolving the underlay address in the endpoint's netns.
+func (e Endpoint) peer(publicKey wgtypes.Key, keepalive time.Duration) (Peer, error) {
+	family := e.Family
+	if family == 0 {
+		family = netlink.FAMILY_V4
+	}
+	if family != netlink.FAMILY_V4 && family != netlink.FAMILY_V6 {
+		return Peer{}, fmt.Errorf("invalid underlay address family for %s: %d", e.Name, family)
+	}
+	addrs := []netlink.Addr{}
+	if err := neslink.Do(e.Ns, neslink.LAGetAddrs(e.Underlay, family, &addrs)); err != nil {
+		return Peer{}, fmt.Errorf("failed to get underlay address for %s: %w", e.Name, err)
+	}
+	var underlayIP net.IP
+	for _, addr := range addrs {
+		if addr.Scope == int(netlink.SCOPE_UNIVERSE) {
+			underlayIP = addr.IP
+			break
+		}
+	}
+	if underlayIP == nil {
+		return Peer{}, fmt.Errorf("failed to get underlay address for %s: underlay link has no global address of the family", e.Name)
+	}
+	allowedIPs := e.AllowedIPs
+	if len(allowedIPs) == 0 {
+		for _, cidr := range e.Addrs {
+			ip, _, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return Peer{}, fmt.Errorf("failed to parse tunnel address: %w", err)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			allowedIPs = append(allowedIPs, (&net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}).String())
+		}
+	}
+	return Peer{
+		PublicKey:  publicKey,
+		Endpoint:   net.JoinHostPort(underlayIP.String(), strconv.Itoa(e.listenPort())),
+		AllowedIPs: allowedIPs,
+		Keepalive:  keepalive,
+	}, nil
+}
+
+// setup creates and configures the wireguard link for the endpoint, with the
+// given private key and peer.
+func (e Endpoint) setup(key wgtypes.Key, peer Peer) error {
+	link := neslink.LPName(e.Name)
+	port := e.listenPort()
+	if err := neslink.Do(e.Ns, neslink.LANewWireguard(e.Name)); err != nil {
+		return fmt.Errorf("failed to create wireguard link %s: %w", e.Name, err)
+	}
+	actions := []neslink.Action{
+		LAConfigure(link, wgtypes.Config{PrivateKey: &key, ListenPort: &port}),
+		LAAddPeer(link, peer),
+	}
+	for _, addr := range e.Addrs {
+		actions = append(actions, neslink.LAAddAddr(link, addr))
+	}
+	actions = append(actions, neslink.LASetUp(link))
+	if err := neslink.Do(e.Ns, actions...); err != nil {
+		return errors.Join(fmt.Errorf("failed to configure wireguard link %s", e.Name), err, neslink.Do(e.Ns, neslink.LADelete(link)))
+	}
+	return nil
+}